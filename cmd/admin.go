@@ -0,0 +1,112 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/spf13/cobra"
+)
+
+// The lock marker goes in the sandbox directory and in every node,
+// so that each "clear" script can find it.
+func lock_dirs(sandbox_dir string) []string {
+	item := common.SandboxItemFromDir(sandbox_dir)
+	dirs := []string{sandbox_dir}
+	if len(item.Nodes) > 0 {
+		dirs = append(dirs, common.NodeDirs(item)...)
+	}
+	return dirs
+}
+
+func LockSandbox(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Sandbox name required.")
+		os.Exit(1)
+	}
+	sandbox_dir := GetSandboxDir(cmd, args[0])
+	lock_text := fmt.Sprintf("locked by dbdeployer on %s\n", time.Now().Format(time.RFC3339))
+	for _, dir := range lock_dirs(sandbox_dir) {
+		err := common.WriteString(lock_text, dir+"/"+common.SandboxLockFile)
+		if err != nil {
+			fmt.Printf("Error creating lock in %s: %s\n", dir, err)
+			os.Exit(1)
+		}
+	}
+	common.UpdateCatalog(common.SandboxItemFromDir(sandbox_dir))
+	fmt.Printf("Sandbox %s locked\n", args[0])
+}
+
+func UnlockSandbox(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Sandbox name required.")
+		os.Exit(1)
+	}
+	sandbox_dir := GetSandboxDir(cmd, args[0])
+	removed := 0
+	for _, dir := range lock_dirs(sandbox_dir) {
+		lock_file := dir + "/" + common.SandboxLockFile
+		if !common.FileExists(lock_file) {
+			continue
+		}
+		err := os.Remove(lock_file)
+		if err != nil {
+			fmt.Printf("Error removing lock in %s: %s\n", dir, err)
+			os.Exit(1)
+		}
+		removed++
+	}
+	if removed == 0 {
+		fmt.Printf("Sandbox %s is not locked\n", args[0])
+		return
+	}
+	common.UpdateCatalog(common.SandboxItemFromDir(sandbox_dir))
+	fmt.Printf("Sandbox %s unlocked\n", args[0])
+}
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administrative tasks on sandboxes",
+	Long:  `Runs commands related to the administration of sandboxes.`,
+}
+
+var adminLockCmd = &cobra.Command{
+	Use:     "lock sandbox_name",
+	Aliases: []string{"preserve"},
+	Short:   "Locks a sandbox, preventing deletion",
+	Long: `Prevents deletion for a given sandbox.
+A locked sandbox can't be removed with "dbdeployer delete", and its
+"clear" and "clear_all" scripts refuse to run.
+The lock is a file named "no_clear" in the sandbox directory and in
+the directory of each node.`,
+	Run: LockSandbox,
+}
+
+var adminUnlockCmd = &cobra.Command{
+	Use:     "unlock sandbox_name",
+	Aliases: []string{"unpreserve"},
+	Short:   "Unlocks a sandbox",
+	Long:    `Removes the lock from a sandbox, allowing deletion and clear.`,
+	Run:     UnlockSandbox,
+}
+
+func init() {
+	rootCmd.AddCommand(adminCmd)
+	adminCmd.AddCommand(adminLockCmd)
+	adminCmd.AddCommand(adminUnlockCmd)
+}
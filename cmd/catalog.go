@@ -0,0 +1,55 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/spf13/cobra"
+)
+
+func RebuildCatalog(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	SandboxHome, _ := flags.GetString("sandbox-home")
+	catalog := common.RebuildCatalog(SandboxHome)
+	fmt.Printf("Catalog %s rebuilt from %s\n", common.SandboxCatalogFile, SandboxHome)
+	fmt.Printf("%d sandboxes recorded\n", len(catalog))
+}
+
+// catalogCmd represents the catalog command
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Operations on the sandbox catalog",
+	Long: `The sandbox catalog ($HOME/.dbdeployer/sandboxes.json) records name, type,
+version, ports, and node directories of every deployment.
+It is updated when a sandbox is deployed or deleted, and it is used
+to find the ports in use and to list the installed sandboxes.`,
+}
+
+// catalogRebuildCmd represents the catalog rebuild command
+var catalogRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Regenerates the sandbox catalog",
+	Long: `Scans the directories in --sandbox-home and regenerates the catalog entries
+for that sandbox home, using the description file of each sandbox.
+Entries for sandboxes that no longer exist are removed.`,
+	Run: RebuildCatalog,
+}
+
+func init() {
+	rootCmd.AddCommand(catalogCmd)
+	catalogCmd.AddCommand(catalogRebuildCmd)
+}
@@ -0,0 +1,150 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/sandbox"
+	"github.com/spf13/cobra"
+)
+
+// Assigns a new port to each of the given ports, starting from first_port
+// and skipping the ports already in use.
+func allocate_ports(old_ports []int, first_port int, used_ports []int) map[int]int {
+	used := make(map[int]bool)
+	for _, port := range used_ports {
+		used[port] = true
+	}
+	ports := make(map[int]int)
+	candidate := first_port
+	for _, old_port := range old_ports {
+		for used[candidate] {
+			candidate++
+		}
+		ports[old_port] = candidate
+		used[candidate] = true
+	}
+	return ports
+}
+
+// Keeps each of the given ports that is not in use. The ports that
+// are taken get new ones, starting from the lowest of the given ports.
+func keep_free_ports(old_ports []int, used_ports []int) map[int]int {
+	used := make(map[int]bool)
+	for _, port := range used_ports {
+		used[port] = true
+	}
+	ports := make(map[int]int)
+	var taken []int
+	min_port := 0
+	for _, port := range old_ports {
+		if min_port == 0 || port < min_port {
+			min_port = port
+		}
+		if used[port] {
+			taken = append(taken, port)
+		} else {
+			ports[port] = port
+		}
+	}
+	// The kept ports are not available for the others
+	reserved := append([]int{}, used_ports...)
+	for port := range ports {
+		reserved = append(reserved, port)
+	}
+	for old_port, new_port := range allocate_ports(taken, min_port, reserved) {
+		ports[old_port] = new_port
+	}
+	return ports
+}
+
+func CloneSandbox(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Println("Source sandbox and new name required.")
+		fmt.Println("You can run 'dbdeployer sandboxes' for a list of available deployments")
+		os.Exit(1)
+	}
+	flags := cmd.Flags()
+	sandbox_home, _ := flags.GetString("sandbox-home")
+	first_port, _ := flags.GetInt("port")
+	source_dir, _ := filepath.Abs(GetSandboxDir(cmd, args[0]))
+	new_dir, err := target_sandbox_dir(sandbox_home, args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	item := common.SandboxItemFromDir(source_dir)
+	check_template_data(item)
+	var old_ports []int
+	max_port := 0
+	for _, port := range item.Port {
+		if port > 0 {
+			old_ports = append(old_ports, port)
+		}
+		if port > max_port {
+			max_port = port
+		}
+	}
+	if first_port == 0 {
+		first_port = max_port + 1
+	}
+	ports := allocate_ports(old_ports, first_port, GetInstalledPorts(sandbox_home))
+
+	// The data directory can only be copied while the server is stopped
+	was_running := StopSandbox(item)
+	fmt.Printf("Copying %s to %s\n", source_dir, new_dir)
+	err = common.CopyDir(source_dir, new_dir)
+	if was_running {
+		StartSandbox(item)
+	}
+	if err != nil {
+		fmt.Printf("Error copying %s to %s: %s\n", source_dir, new_dir, err)
+		os.RemoveAll(new_dir)
+		os.Exit(1)
+	}
+	for _, old_port := range old_ports {
+		fmt.Printf("Port %d => %d\n", old_port, ports[old_port])
+	}
+	sandbox.RewriteClonedSandbox(source_dir, new_dir, ports)
+	sandbox.StartClonedSandbox(new_dir)
+	common.UpdateCatalog(common.SandboxItemFromDir(new_dir))
+	fmt.Printf("Sandbox %s cloned to %s\n", args[0], new_dir)
+}
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone source_sandbox new_name_or_path",
+	Short: "Creates a copy of a sandbox, data included",
+	Long: `Creates a new sandbox with a copy of the data of an existing one.
+The source sandbox is stopped during the copy, and restarted afterwards.
+The new sandbox gets new ports (starting from --port, or after the
+ports of the source), new server IDs, new server UUIDs, and scripts
+for its own directory.
+In replication sandboxes, every node is cloned, and the slaves are
+pointed to the new master, continuing from the same position.`,
+	Example: `
+	$ dbdeployer clone msb_5_7_21 msb_experiment1
+	$ dbdeployer clone rsandbox_5_7_21 rsandbox_test --port=31000
+`,
+	Run: CloneSandbox,
+}
+
+func init() {
+	rootCmd.AddCommand(cloneCmd)
+}
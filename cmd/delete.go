@@ -17,82 +17,241 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
 	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/sandbox"
 	"github.com/spf13/cobra"
-	"os"
 )
 
+// Makes sure that a directory is a sandbox that we can remove:
+// it must be directly inside the sandbox home, and must contain
+// a sandbox description.
+func check_removable_sandbox(sandbox_home, sandbox_dir string) error {
+	home, err := filepath.Abs(sandbox_home)
+	if err != nil {
+		return err
+	}
+	full_path, err := filepath.Abs(sandbox_dir)
+	if err != nil {
+		return err
+	}
+	if path.Dir(full_path) != home {
+		return fmt.Errorf("directory '%s' is not inside %s", full_path, home)
+	}
+	stat, err := os.Lstat(full_path)
+	if err != nil {
+		return err
+	}
+	if stat.Mode()&os.ModeSymlink != 0 || !stat.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", full_path)
+	}
+	if !common.FileExists(full_path + "/sbdescription.json") {
+		return fmt.Errorf("directory '%s' does not contain a sandbox description", full_path)
+	}
+	return nil
+}
+
+// Finds the sandboxes requested for deletion.
+// Arguments can be sandbox names, shell patterns, or "ALL".
+func find_sandboxes_to_delete(cmd *cobra.Command, args []string) []common.SandboxItem {
+	sandbox_home, _ := cmd.Flags().GetString("sandbox-home")
+	filter := GetSandboxFilter(cmd)
+	catalog_items := common.CatalogItems(sandbox_home)
+	var selected []common.SandboxItem
+	if len(args) == 0 {
+		// Only filters were given
+		return common.FilterSandboxes(catalog_items, filter)
+	}
+	seen := make(map[string]bool)
+	add := func(item common.SandboxItem) {
+		if !seen[item.Name] {
+			seen[item.Name] = true
+			selected = append(selected, item)
+		}
+	}
+	for _, arg := range args {
+		if arg == "ALL" {
+			for _, item := range catalog_items {
+				add(item)
+			}
+			continue
+		}
+		if strings.ContainsAny(arg, "*?[") {
+			matching := common.FilterSandboxes(catalog_items, common.SandboxFilter{NamePattern: arg})
+			if len(matching) == 0 {
+				fmt.Printf("No sandboxes matching '%s'\n", arg)
+			}
+			for _, item := range matching {
+				add(item)
+			}
+			continue
+		}
+		found := false
+		for _, item := range catalog_items {
+			if item.Name == arg {
+				add(item)
+				found = true
+			}
+		}
+		if !found {
+			// The catalog may be out of date: look for the directory
+			sandbox_dir := sandbox_home + "/" + arg
+			if !common.DirExists(sandbox_dir) {
+				fmt.Printf("Directory '%s' not found\n", sandbox_dir)
+				os.Exit(1)
+			}
+			err := check_removable_sandbox(sandbox_home, sandbox_dir)
+			if err != nil {
+				fmt.Printf("Can't delete %s: %s\n", arg, err)
+				os.Exit(1)
+			}
+			add(common.SandboxItemFromDir(sandbox_dir))
+		}
+	}
+	return common.FilterSandboxes(selected, filter)
+}
+
+func confirm_deletion(items []common.SandboxItem) {
+	fmt.Println("We're about to delete:")
+	for _, item := range items {
+		fmt.Printf("    %s\n", item.Destination)
+	}
+	fmt.Printf("Do you confirm? y/[N] ")
+
+	bio := bufio.NewReader(os.Stdin)
+	line, _, err := bio.ReadLine()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	answer := string(line)
+	if answer == "y" || answer == "Y" {
+		fmt.Println("Proceeding with deletion")
+	} else {
+		fmt.Println("Execution interrupted by user")
+		os.Exit(0)
+	}
+}
+
 func DeleteSandbox(cmd *cobra.Command, args []string) {
-	if len(args) < 1 {
+	flags := cmd.Flags()
+	filter := GetSandboxFilter(cmd)
+	if len(args) < 1 && filter == (common.SandboxFilter{}) {
 		fmt.Println("Sandbox name required.")
-		fmt.Println("You can run 'dbdeployer sandboxes for a list of available deployments'")
+		fmt.Println("You can run 'dbdeployer sandboxes' for a list of available deployments")
 		os.Exit(1)
 	}
-	flags := cmd.Flags()
-	sandbox := args[0]
 	confirm, _ := flags.GetBool("confirm")
-	sandbox_dir, _ := flags.GetString("sandbox-home")
-	full_path := sandbox_dir + "/" + sandbox
-	if !common.DirExists(full_path) {
-		fmt.Println("Directory '%s' not found\n", full_path)
-		os.Exit(1)
+	skip_confirm, _ := flags.GetBool("skip-confirm")
+	sandbox_home, _ := flags.GetString("sandbox-home")
+
+	var items []common.SandboxItem
+	var locked []string
+	for _, item := range find_sandboxes_to_delete(cmd, args) {
+		err := check_removable_sandbox(sandbox_home, item.Destination)
+		if err != nil {
+			fmt.Printf("Can't delete %s: %s\n", item.Name, err)
+			os.Exit(1)
+		}
+		// The lock is checked on disk, as the catalog may be outdated
+		if common.IsSandboxLocked(item.Destination) {
+			fmt.Printf("Sandbox %s is locked. Run 'dbdeployer admin unlock %s' to delete it\n", item.Name, item.Name)
+			locked = append(locked, item.Name)
+			continue
+		}
+		items = append(items, item)
 	}
-	stop := full_path + "/stop_all"
-	if !common.ExecExists(stop) {
-		stop = full_path + "/stop"
+	if len(items) == 0 {
+		fmt.Println("No sandboxes to delete")
+		if len(locked) > 0 {
+			os.Exit(1)
+		}
+		return
 	}
-	if !common.ExecExists(stop) {
-		fmt.Println("Executable '%s' not found\n", stop)
-		os.Exit(1)
+	// Removing more than one sandbox requires confirmation,
+	// unless explicitly skipped
+	if (confirm || len(items) > 1) && !skip_confirm {
+		confirm_deletion(items)
 	}
-	if confirm {
-		fmt.Printf("We're about to delete %s\n", full_path)
-		fmt.Printf("Do you confirm? y/[N] ")
 
-		bio := bufio.NewReader(os.Stdin)
-		line, _, err := bio.ReadLine()
-		if err != nil {
-			fmt.Println(err)
-		} else {
-			answer := string(line)
-			if answer == "y" || answer == "Y" {
-				fmt.Println("Proceeding with deletion")
-			} else {
-				fmt.Println("Execution interrupted by user")
-				os.Exit(0)
+	var stopped []string
+	var removed []string
+	var failed []string
+	for _, item := range items {
+		full_path := item.Destination
+		if common.SandboxStatus(item) != common.StatusStopped {
+			stop := full_path + "/stop_all"
+			if !common.ExecExists(stop) {
+				stop = full_path + "/stop"
 			}
+			if !common.ExecExists(stop) {
+				fmt.Printf("Executable '%s' not found\n", stop)
+				failed = append(failed, item.Name)
+				continue
+			}
+			fmt.Printf("Running %s\n", stop)
+			err := common.Run_cmd(stop)
+			if err != nil || common.SandboxStatus(item) != common.StatusStopped {
+				fmt.Printf("Error while stopping sandbox %s\n", full_path)
+				failed = append(failed, item.Name)
+				continue
+			}
+			stopped = append(stopped, item.Name)
 		}
-	}
-	fmt.Printf("Running %s\n", stop)
-	err := common.Run_cmd(stop)
-	if err != nil {
-		fmt.Printf("Error while stopping sandbox %s\n", full_path)
-		os.Exit(1)
+		fmt.Printf("Removing %s\n", full_path)
+		err := os.RemoveAll(full_path)
+		if err != nil {
+			fmt.Printf("Error while deleting sandbox %s: %s\n", full_path, err)
+			failed = append(failed, item.Name)
+			continue
+		}
+		common.RemoveFromCatalog(full_path)
+		// Otherwise, a new sandbox with the same name would find them
+		err = os.RemoveAll(sandbox.SnapshotDir(full_path))
+		if err != nil {
+			fmt.Printf("Error while deleting the snapshots of %s: %s\n", full_path, err)
+			failed = append(failed, item.Name)
+			continue
+		}
+		removed = append(removed, item.Name)
 	}
 
-	rm_cmd := []string{"-rf", full_path}
-	cmd_str := "rm"
-	for _, item := range rm_cmd {
-		cmd_str += " " + item
+	fmt.Println("")
+	fmt.Printf("Stopped: %d %s\n", len(stopped), strings.Join(stopped, " "))
+	fmt.Printf("Removed: %d %s\n", len(removed), strings.Join(removed, " "))
+	if len(locked) > 0 {
+		fmt.Printf("Locked:  %d %s\n", len(locked), strings.Join(locked, " "))
 	}
-	fmt.Printf("Running %s\n", cmd_str)
-	err = common.Run_cmd_with_args("rm", rm_cmd)
-	if err != nil {
-		fmt.Printf("Error while deleting sandbox %s\n", full_path)
+	if len(failed) > 0 {
+		fmt.Printf("Failed:  %d %s\n", len(failed), strings.Join(failed, " "))
 		os.Exit(1)
 	}
-	fmt.Printf("Sandbox %s deleted\n", full_path)
 }
 
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
-	Use:     "delete sandbox_name",
+	Use:     "delete sandbox_name [sandbox_name ...] | ALL",
 	Short:   "delete an installed sandbox",
 	Aliases: []string{"remove", "destroy"},
 	Example: `
 	$ dbdeployer delete msb_8_0_4
-	$ dbdeployer delete rsandbox_5_7_21`,
+	$ dbdeployer delete rsandbox_5_7_21
+	$ dbdeployer delete 'msb_5_7*' --skip-confirm
+	$ dbdeployer delete --version=5.6 --type=single
+	$ dbdeployer delete ALL`,
 	Long: `Stops the sandbox (and its depending sandboxes, if any), and removes it.
+Several sandboxes can be given at once, either by name, by shell pattern,
+or using "ALL" for all the sandboxes in --sandbox-home. The selection can
+be further restricted with --version, --type, and --name.
+Only directories inside --sandbox-home that contain a sandbox description
+are removed, together with the snapshots of each sandbox. Sandboxes
+locked with 'dbdeployer admin lock' are skipped. When more than one
+sandbox is selected, a confirmation is requested, unless --skip-confirm
+is used.
 Warning: this command is irreversible!`,
 	Run: DeleteSandbox,
 }
@@ -101,4 +260,6 @@ func init() {
 	rootCmd.AddCommand(deleteCmd)
 
 	deleteCmd.Flags().BoolP("confirm", "", false, "Requires confirmation.")
+	deleteCmd.Flags().BoolP("skip-confirm", "", false, "Skips the confirmation request when deleting several sandboxes.")
+	AddSandboxFilterFlags(deleteCmd.Flags())
 }
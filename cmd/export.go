@@ -0,0 +1,78 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/spf13/cobra"
+)
+
+func ExportSandbox(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Println("Sandbox name and archive name required.")
+		os.Exit(1)
+	}
+	sandbox_dir, _ := filepath.Abs(GetSandboxDir(cmd, args[0]))
+	archive, _ := filepath.Abs(args[1])
+	if !strings.HasSuffix(archive, ".tar.gz") && !strings.HasSuffix(archive, ".tgz") {
+		fmt.Println("The archive name must end with .tar.gz or .tgz")
+		os.Exit(1)
+	}
+	if common.FileExists(archive) {
+		fmt.Printf("File %s already exists\n", archive)
+		os.Exit(1)
+	}
+	item := common.SandboxItemFromDir(sandbox_dir)
+	check_template_data(item)
+
+	// The data directories are only consistent while the servers are stopped
+	was_running := StopSandbox(item)
+	fmt.Printf("Exporting %s to %s\n", sandbox_dir, archive)
+	err := common.CreateTarGz(archive, path.Dir(sandbox_dir), []string{path.Base(sandbox_dir)})
+	if was_running {
+		StartSandbox(item)
+	}
+	if err != nil {
+		fmt.Printf("Error exporting %s: %s\n", args[0], err)
+		os.Exit(1)
+	}
+	fmt.Printf("Sandbox %s exported to %s\n", args[0], archive)
+}
+
+var exportSandboxCmd = &cobra.Command{
+	Use:   "export sandbox_name archive.tar.gz",
+	Short: "Saves a sandbox to a portable archive",
+	Long: `Creates a compressed archive with a sandbox directory, including data,
+sandbox description, and template data. The server binaries are not
+included: the host where the archive is imported must have the same
+version in its --sandbox-binary directory.
+The sandbox is stopped while the archive is created, and restarted
+afterwards.
+Use "dbdeployer import" to deploy the archive.`,
+	Example: `
+	$ dbdeployer export rsandbox_5_7_21 bug_12345.tar.gz
+`,
+	Run: ExportSandbox,
+}
+
+func init() {
+	rootCmd.AddCommand(exportSandboxCmd)
+}
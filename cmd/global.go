@@ -0,0 +1,182 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/spf13/cobra"
+)
+
+// Runs a script in every sandbox selected by the filters.
+// Single sandboxes use the script with the given name, while
+// composite sandboxes use the corresponding "_all" script.
+func RunGlobalCommand(cmd *cobra.Command, script string, single_args, multi_args []string) {
+	flags := cmd.Flags()
+	sandbox_home, _ := flags.GetString("sandbox-home")
+	items := common.FilterSandboxes(common.CatalogItems(sandbox_home), GetSandboxFilter(cmd))
+	if len(items) == 0 {
+		fmt.Printf("No sandboxes found in %s\n", sandbox_home)
+		return
+	}
+	var succeeded []string
+	var failed []string
+	// Only for "status": sandboxes that are not (fully) running
+	var not_running []string
+	for _, item := range items {
+		script_name := script
+		args := single_args
+		if len(item.Nodes) > 0 {
+			script_name = script + "_all"
+			args = multi_args
+		}
+		executable := item.Destination + "/" + script_name
+		fmt.Printf("# Running \"%s\" on %s\n", script_name, item.Name)
+		if !common.ExecExists(executable) {
+			fmt.Printf("Executable '%s' not found\n", executable)
+			failed = append(failed, item.Name)
+			continue
+		}
+		output, err := common.Run_cmd_output(executable, args)
+		fmt.Print(output)
+		if err != nil {
+			// "status" exits with an error when a server is not running,
+			// which is not a failure of the command
+			status := common.SandboxStatus(item)
+			if script == "status" && status != common.StatusRunning {
+				not_running = append(not_running, fmt.Sprintf("%s: %s", status, item.Name))
+				continue
+			}
+			fmt.Printf("# %s: %s\n", item.Name, err)
+			failed = append(failed, item.Name)
+		} else {
+			succeeded = append(succeeded, item.Name)
+		}
+	}
+	fmt.Println("")
+	fmt.Printf("# \"%s\" succeeded in %d sandboxes, failed in %d\n", script, len(succeeded), len(failed))
+	for _, name := range not_running {
+		fmt.Printf("# %s\n", name)
+	}
+	for _, name := range failed {
+		fmt.Printf("# failed: %s\n", name)
+	}
+	if len(failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func GlobalStart(cmd *cobra.Command, args []string) {
+	RunGlobalCommand(cmd, "start", args, args)
+}
+
+func GlobalRestart(cmd *cobra.Command, args []string) {
+	RunGlobalCommand(cmd, "restart", args, args)
+}
+
+func GlobalStop(cmd *cobra.Command, args []string) {
+	RunGlobalCommand(cmd, "stop", args, args)
+}
+
+func GlobalStatus(cmd *cobra.Command, args []string) {
+	RunGlobalCommand(cmd, "status", args, args)
+}
+
+func GlobalTest(cmd *cobra.Command, args []string) {
+	RunGlobalCommand(cmd, "test_sb", args, args)
+}
+
+func GlobalUse(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Query required")
+		os.Exit(1)
+	}
+	// "use" passes its arguments to the client, while
+	// "use_all" sends them to every node as a query
+	RunGlobalCommand(cmd, "use", []string{"-e", args[0]}, args[0:1])
+}
+
+var globalCmd = &cobra.Command{
+	Use:   "global",
+	Short: "Runs a given command in every sandbox",
+	Long: `Runs a given command in every sandbox of --sandbox-home.
+Single sandboxes use their own script (e.g. "stop"), while composite
+sandboxes use the script that runs on all nodes (e.g. "stop_all").
+A summary of the sandboxes where the command succeeded or failed is
+shown at the end. For "status", sandboxes that are stopped or partially
+running are listed as such, and are not counted as failures.
+The sandboxes can be restricted using --version, --type, and --name.`,
+	Example: `
+	$ dbdeployer global stop
+	$ dbdeployer global status --type=single
+	$ dbdeployer global use "select @@version, @@server_id" --version=5.7
+	$ dbdeployer global restart --name='rsandbox*'
+`,
+}
+
+var globalStartCmd = &cobra.Command{
+	Use:   "start [options]",
+	Short: "Starts all sandboxes",
+	Long:  `Starts all sandboxes. Options are passed to the start scripts.`,
+	Run:   GlobalStart,
+}
+
+var globalRestartCmd = &cobra.Command{
+	Use:   "restart [options]",
+	Short: "Restarts all sandboxes",
+	Long:  `Restarts all sandboxes. Options are passed to the restart scripts.`,
+	Run:   GlobalRestart,
+}
+
+var globalStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stops all sandboxes",
+	Run:   GlobalStop,
+}
+
+var globalStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the status in all sandboxes",
+	Run:   GlobalStatus,
+}
+
+var globalTestCmd = &cobra.Command{
+	Use:     "test",
+	Aliases: []string{"test_sb", "test-sb"},
+	Short:   "Tests all sandboxes",
+	Run:     GlobalTest,
+}
+
+var globalUseCmd = &cobra.Command{
+	Use:   "use {query}",
+	Short: "Runs a query in all sandboxes",
+	Long: `Runs a query in all sandboxes.
+In composite sandboxes, the query runs in every node.`,
+	Run: GlobalUse,
+}
+
+func init() {
+	rootCmd.AddCommand(globalCmd)
+	globalCmd.AddCommand(globalStartCmd)
+	globalCmd.AddCommand(globalRestartCmd)
+	globalCmd.AddCommand(globalStopCmd)
+	globalCmd.AddCommand(globalStatusCmd)
+	globalCmd.AddCommand(globalTestCmd)
+	globalCmd.AddCommand(globalUseCmd)
+
+	AddSandboxFilterFlags(globalCmd.PersistentFlags())
+}
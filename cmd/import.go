@@ -0,0 +1,178 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/sandbox"
+	"github.com/datacharmer/dbdeployer/unpack"
+	"github.com/spf13/cobra"
+)
+
+// Returns the sandbox directory found in an extracted archive.
+// The archive must contain exactly one sandbox.
+func find_imported_sandbox(extract_dir string) (string, error) {
+	files, err := ioutil.ReadDir(extract_dir)
+	if err != nil {
+		return "", err
+	}
+	if len(files) != 1 || !files[0].IsDir() {
+		return "", fmt.Errorf("the archive must contain a single sandbox directory")
+	}
+	sandbox_dir := extract_dir + "/" + files[0].Name()
+	if !common.FileExists(sandbox_dir + "/sbdescription.json") {
+		return "", fmt.Errorf("directory %s does not contain a sandbox description", files[0].Name())
+	}
+	return sandbox_dir, nil
+}
+
+// Returns the directory of the binaries for an imported sandbox: the
+// original one, when it exists on this host (as for a sandbox deployed
+// from a full path), or the one of its version in --sandbox-binary.
+// Returns an empty string if none is found.
+func imported_basedir(sbd common.SandboxDescription, sandbox_binary string) string {
+	if sbd.Basedir != "" && common.DirExists(sbd.Basedir) {
+		return sbd.Basedir
+	}
+	candidates := []string{sbd.Version}
+	// The version of a sandbox deployed from a full path has no prefix
+	prefix := common.FlavorPrefixes[sbd.Flavor]
+	if prefix != "" && !strings.HasPrefix(sbd.Version, prefix) {
+		candidates = append(candidates, prefix+sbd.Version)
+	}
+	for _, candidate := range candidates {
+		if common.DirExists(sandbox_binary + "/" + candidate) {
+			return sandbox_binary + "/" + candidate
+		}
+	}
+	return ""
+}
+
+func ImportSandbox(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Archive name required.")
+		os.Exit(1)
+	}
+	flags := cmd.Flags()
+	sandbox_home, _ := flags.GetString("sandbox-home")
+	sandbox_binary, _ := flags.GetString("sandbox-binary")
+	first_port, _ := flags.GetInt("port")
+	archive, _ := filepath.Abs(args[0])
+	if !common.FileExists(archive) {
+		fmt.Printf("File %s not found\n", archive)
+		os.Exit(1)
+	}
+	common.CheckSandboxDir(sandbox_home)
+
+	// The archive is extracted inside --sandbox-home, so that the
+	// sandbox can be moved to its final place with a rename.
+	extract_dir, err := ioutil.TempDir(sandbox_home, ".import_")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	abort := func(format string, a ...interface{}) {
+		os.RemoveAll(extract_dir)
+		fmt.Printf(format, a...)
+		os.Exit(1)
+	}
+	fmt.Printf("Extracting %s\n", archive)
+	err = unpack.UnpackTar(archive, extract_dir, unpack.SILENT)
+	if err != nil {
+		abort("Error extracting %s: %s\n", archive, err)
+	}
+	extracted, err := find_imported_sandbox(extract_dir)
+	if err != nil {
+		abort("Error in archive %s: %s\n", archive, err)
+	}
+	item := common.SandboxItemFromDir(extracted)
+	for _, dir := range append([]string{item.Destination}, common.NodeDirs(item)...) {
+		if !sandbox.HasTemplateData(dir) {
+			abort("Directory %s does not contain %s\n", filepath.Base(dir), sandbox.TemplateDataFile)
+		}
+	}
+	sbd := common.ReadSandboxDescription(extracted)
+	basedir := imported_basedir(sbd, sandbox_binary)
+	if basedir == "" {
+		abort("The sandbox requires version %s, which was not found in %s or %s\n", sbd.Version, sbd.Basedir, sandbox_binary)
+	}
+	old_dir, _ := sandbox.ReadTemplateData(extracted)["SandboxDir"].(string)
+	if old_dir == "" {
+		abort("The template data of %s does not contain the sandbox directory\n", filepath.Base(extracted))
+	}
+	name := filepath.Base(extracted)
+	if len(args) > 1 {
+		name = args[1]
+	}
+	new_dir, err := target_sandbox_dir(sandbox_home, name)
+	if err != nil {
+		abort("%s\n", err)
+	}
+
+	// Unless --port is given, the sandbox keeps its original ports if they are free
+	var old_ports []int
+	for _, port := range item.Port {
+		if port > 0 {
+			old_ports = append(old_ports, port)
+		}
+	}
+	var ports map[int]int
+	if first_port == 0 {
+		ports = keep_free_ports(old_ports, GetInstalledPorts(sandbox_home))
+	} else {
+		ports = allocate_ports(old_ports, first_port, GetInstalledPorts(sandbox_home))
+	}
+
+	err = os.Rename(extracted, new_dir)
+	if err != nil {
+		abort("Error moving the sandbox to %s: %s\n", new_dir, err)
+	}
+	os.RemoveAll(extract_dir)
+	for _, old_port := range old_ports {
+		fmt.Printf("Port %d => %d\n", old_port, ports[old_port])
+	}
+	sandbox.RewriteImportedSandbox(old_dir, new_dir, basedir, ports)
+	sandbox.StartClonedSandbox(new_dir)
+	common.UpdateCatalog(common.SandboxItemFromDir(new_dir))
+	fmt.Printf("Sandbox imported to %s\n", new_dir)
+}
+
+var importSandboxCmd = &cobra.Command{
+	Use:   "import archive.tar.gz [new_name_or_path]",
+	Short: "Deploys a sandbox from an exported archive",
+	Long: `Deploys a sandbox that was saved with "dbdeployer export".
+The binaries of the sandbox are taken from its original base directory,
+if it exists on this host, or else from its version in --sandbox-binary.
+With --port, the sandbox gets the first free ports starting from it.
+Otherwise, it keeps each of its original ports that is free, and only
+the ports already in use are replaced with free ones. The scripts are
+written again for the new location, the local server binaries, and
+the current operating system user, and the sandbox is started.`,
+	Example: `
+	$ dbdeployer import bug_12345.tar.gz
+	$ dbdeployer import bug_12345.tar.gz rsandbox_bug_12345 --port=31000
+`,
+	Run: ImportSandbox,
+}
+
+func init() {
+	rootCmd.AddCommand(importSandboxCmd)
+}
@@ -0,0 +1,240 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/spf13/cobra"
+)
+
+type user_info struct {
+	User       string `json:"user"`
+	Password   string `json:"password"`
+	Privileges string `json:"privileges"`
+}
+
+type node_info struct {
+	Name       string      `json:"name"`
+	Role       string      `json:"role"`
+	Directory  string      `json:"directory"`
+	Basedir    string      `json:"basedir"`
+	Version    string      `json:"version"`
+	Port       []int       `json:"port"`
+	Host       string      `json:"host"`
+	Socket     string      `json:"socket"`
+	Datadir    string      `json:"datadir"`
+	ErrorLog   string      `json:"error_log"`
+	ServerId   int         `json:"server_id"`
+	ServerUUID string      `json:"server_uuid"`
+	Users      []user_info `json:"users"`
+	DSN        string      `json:"dsn"`
+}
+
+type sandbox_info struct {
+	Name    string      `json:"name"`
+	SBType  string      `json:"type"`
+	Version string      `json:"version"`
+	Nodes   []node_info `json:"nodes"`
+}
+
+// Returns the directory of a sandbox, given its name.
+// Exits with an error if the directory does not contain a sandbox.
+func GetSandboxDir(cmd *cobra.Command, sandbox_name string) string {
+	sandbox_home, _ := cmd.Flags().GetString("sandbox-home")
+	sandbox_dir := sandbox_home + "/" + sandbox_name
+	if !common.DirExists(sandbox_dir) {
+		fmt.Printf("Directory '%s' not found\n", sandbox_dir)
+		fmt.Println("You can run 'dbdeployer sandboxes' for a list of available deployments")
+		os.Exit(1)
+	}
+	if !common.FileExists(sandbox_dir + "/sbdescription.json") {
+		fmt.Printf("Directory '%s' does not contain a sandbox description\n", sandbox_dir)
+		os.Exit(1)
+	}
+	return sandbox_dir
+}
+
+// Collects the connection details of one node, using its description
+// and its configuration file.
+func get_node_info(sbd common.SandboxDescription, node common.NodeDescription) node_info {
+	cnf := common.ParseMyCnf(node.Directory + "/my.sandbox.cnf")
+	info := node_info{
+		Name:       node.Name,
+		Role:       node.Role,
+		Directory:  node.Directory,
+		Basedir:    cnf.Option("mysqld", "basedir"),
+		Version:    sbd.Version,
+		Port:       node.Port,
+		Host:       cnf.Option("mysqld", "bind-address"),
+		Socket:     node.Socket,
+		Datadir:    cnf.Option("mysqld", "datadir"),
+		ServerId:   node.ServerId,
+		ServerUUID: node.ServerUUID,
+	}
+	if info.Basedir == "" {
+		info.Basedir = sbd.Basedir
+	}
+	if info.Datadir == "" {
+		info.Datadir = node.Directory + "/data"
+	}
+	if info.Socket == "" {
+		info.Socket = cnf.Option("mysqld", "socket")
+	}
+	if info.Host == "" || info.Host == "0.0.0.0" {
+		info.Host = "127.0.0.1"
+	}
+	if len(info.Port) == 0 {
+		port, _ := strconv.Atoi(cnf.Option("mysqld", "port"))
+		info.Port = []int{port}
+	}
+	info.ErrorLog = cnf.Option("mysqld", "log-error")
+	if info.ErrorLog == "" {
+		info.ErrorLog = "msandbox.err"
+	}
+	if !strings.HasPrefix(info.ErrorLog, "/") {
+		// A relative error log is created in the data directory
+		info.ErrorLog = info.Datadir + "/" + info.ErrorLog
+	}
+	db_user := cnf.Option("client", "user")
+	db_password := cnf.Option("client", "password")
+	if db_user == "" {
+		db_user = sbd.DbUser
+	}
+	// These users are created by the grants templates
+	info.Users = []user_info{
+		{"root", db_password, "ALL (localhost only)"},
+		{db_user, db_password, "ALL"},
+		{"msandbox_rw", db_password, "SELECT,INSERT,UPDATE,DELETE,CREATE,DROP,INDEX,ALTER,SHOW DATABASES,CREATE TEMPORARY TABLES,LOCK TABLES,EXECUTE"},
+		{"msandbox_ro", db_password, "SELECT,EXECUTE"},
+	}
+	if sbd.RplUser != "" {
+		info.Users = append(info.Users, user_info{sbd.RplUser, sbd.RplPassword, "REPLICATION SLAVE"})
+	}
+	info.DSN = fmt.Sprintf("mysql://%s:%s@%s:%d/", db_user, db_password, info.Host, info.Port[0])
+	return info
+}
+
+func print_node_info(info node_info) {
+	port_text := ""
+	for _, p := range info.Port {
+		if port_text != "" {
+			port_text += " "
+		}
+		port_text += fmt.Sprintf("%d", p)
+	}
+	fmt.Printf("%-12s : %s (%s)\n", "node", info.Name, info.Role)
+	fmt.Printf("%-12s : %s\n", "directory", info.Directory)
+	fmt.Printf("%-12s : %s\n", "basedir", info.Basedir)
+	fmt.Printf("%-12s : %s\n", "version", info.Version)
+	fmt.Printf("%-12s : %s\n", "port", port_text)
+	fmt.Printf("%-12s : %s\n", "host", info.Host)
+	fmt.Printf("%-12s : %s\n", "socket", info.Socket)
+	fmt.Printf("%-12s : %s\n", "datadir", info.Datadir)
+	fmt.Printf("%-12s : %s\n", "error log", info.ErrorLog)
+	fmt.Printf("%-12s : %d\n", "server_id", info.ServerId)
+	fmt.Printf("%-12s : %s\n", "server_uuid", info.ServerUUID)
+	for _, user := range info.Users {
+		fmt.Printf("%-12s : %-12s %-10s %s\n", "user", user.User, user.Password, user.Privileges)
+	}
+	fmt.Printf("%-12s : %s\n", "dsn", info.DSN)
+}
+
+func print_info_json(info interface{}) {
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding sandbox information: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(b))
+}
+
+func ShowInfo(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Sandbox name required.")
+		fmt.Println("You can run 'dbdeployer sandboxes' for a list of available deployments")
+		os.Exit(1)
+	}
+	flags := cmd.Flags()
+	node_number, _ := flags.GetInt("node")
+	format, _ := flags.GetString("format")
+	if format != "text" && format != "json" {
+		fmt.Printf("Unknown format '%s'. Use one of: text, json\n", format)
+		os.Exit(1)
+	}
+	sandbox_dir := GetSandboxDir(cmd, args[0])
+	sbd := common.ReadSandboxDescription(sandbox_dir)
+	info := sandbox_info{
+		Name:    path.Base(sandbox_dir),
+		SBType:  sbd.SBType,
+		Version: sbd.Version,
+	}
+	for _, node := range sbd.NodeList {
+		info.Nodes = append(info.Nodes, get_node_info(sbd, node))
+	}
+	if node_number > 0 {
+		// Nodes are numbered as in the n1, n2, n3 scripts
+		if node_number > len(info.Nodes) {
+			fmt.Printf("Sandbox %s has %d nodes. Node %d requested\n", info.Name, len(info.Nodes), node_number)
+			os.Exit(1)
+		}
+		node := info.Nodes[node_number-1]
+		if format == "json" {
+			print_info_json(node)
+		} else {
+			print_node_info(node)
+		}
+		return
+	}
+	if format == "json" {
+		print_info_json(info)
+		return
+	}
+	fmt.Printf("%-12s : %s\n", "sandbox", info.Name)
+	fmt.Printf("%-12s : %s\n", "type", info.SBType)
+	fmt.Printf("%-12s : %s\n", "version", info.Version)
+	for _, node := range info.Nodes {
+		fmt.Println("")
+		print_node_info(node)
+	}
+}
+
+// infoCmd represents the info command
+var infoCmd = &cobra.Command{
+	Use:   "info sandbox_name",
+	Short: "Shows connection details of a sandbox",
+	Long: `Shows the details needed to connect to the servers of a sandbox:
+basedir, version, ports, socket, data directory, error log, users,
+server ID, and a DSN for each node.
+With --node=N, only the Nth node is shown (numbered as in the n1, n2,
+n3 scripts.) With --format=json, the output can be used by programs.
+	$ dbdeployer info msb_5_7_21
+	$ dbdeployer info rsandbox_5_7_21 --node=2 --format=json
+`,
+	Run: ShowInfo,
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+
+	infoCmd.Flags().Int("node", 0, "Shows only the given node (1 for the first node)")
+	infoCmd.Flags().String("format", "text", "Output format: text, json")
+}
@@ -0,0 +1,164 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/sandbox"
+	"github.com/spf13/cobra"
+)
+
+// Returns the script that runs an operation on the whole sandbox
+// (e.g. "stop_all" for composite sandboxes, "stop" for single ones)
+func sandbox_script(item common.SandboxItem, operation string) string {
+	if len(item.Nodes) > 0 {
+		return item.Destination + "/" + operation + "_all"
+	}
+	return item.Destination + "/" + operation
+}
+
+// Stops a sandbox if it is running.
+// Returns true if the sandbox was running.
+func StopSandbox(item common.SandboxItem) bool {
+	if common.SandboxStatus(item) == common.StatusStopped {
+		return false
+	}
+	stop := sandbox_script(item, "stop")
+	fmt.Printf("Running %s\n", stop)
+	err := common.Run_cmd(stop)
+	if err != nil || common.SandboxStatus(item) != common.StatusStopped {
+		fmt.Printf("Error while stopping sandbox %s\n", item.Destination)
+		os.Exit(1)
+	}
+	return true
+}
+
+func StartSandbox(item common.SandboxItem) {
+	start := sandbox_script(item, "start")
+	fmt.Printf("Running %s\n", start)
+	err := common.Run_cmd(start)
+	if err != nil {
+		fmt.Printf("Error while starting sandbox %s\n", item.Destination)
+		os.Exit(1)
+	}
+}
+
+// Makes sure that all the directories of a sandbox contain
+// the template data needed to write the scripts again.
+func check_template_data(item common.SandboxItem) {
+	dirs := []string{item.Destination}
+	if len(item.Nodes) > 0 {
+		dirs = append(dirs, common.NodeDirs(item)...)
+	}
+	for _, dir := range dirs {
+		if !sandbox.HasTemplateData(dir) {
+			fmt.Printf("Directory %s does not contain %s\n", dir, sandbox.TemplateDataFile)
+			fmt.Println("The sandbox was created by an older version of dbdeployer, and its scripts can't be regenerated")
+			os.Exit(1)
+		}
+	}
+}
+
+// Returns the full path of the destination of a sandbox.
+// A simple name is placed in --sandbox-home, while a path is used as is.
+func target_sandbox_dir(sandbox_home, target string) (string, error) {
+	if !strings.Contains(target, "/") {
+		target = sandbox_home + "/" + target
+	}
+	full_path, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	if common.DirExists(full_path) || common.FileExists(full_path) {
+		return "", fmt.Errorf("destination %s already exists", full_path)
+	}
+	// The new sandbox would take the snapshots of another one
+	if common.DirExists(sandbox.SnapshotDir(full_path)) {
+		return "", fmt.Errorf("snapshot directory %s already exists", sandbox.SnapshotDir(full_path))
+	}
+	if !common.DirExists(path.Dir(full_path)) {
+		return "", fmt.Errorf("directory %s does not exist", path.Dir(full_path))
+	}
+	return full_path, nil
+}
+
+func MoveSandbox(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Println("Sandbox name and destination required.")
+		fmt.Println("You can run 'dbdeployer sandboxes' for a list of available deployments")
+		os.Exit(1)
+	}
+	sandbox_home, _ := cmd.Flags().GetString("sandbox-home")
+	sandbox_dir, _ := filepath.Abs(GetSandboxDir(cmd, args[0]))
+	new_dir, err := target_sandbox_dir(sandbox_home, args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	item := common.SandboxItemFromDir(sandbox_dir)
+	check_template_data(item)
+	was_running := StopSandbox(item)
+
+	fmt.Printf("Moving %s to %s\n", sandbox_dir, new_dir)
+	err = os.Rename(sandbox_dir, new_dir)
+	if err != nil {
+		fmt.Printf("Error moving %s to %s: %s\n", sandbox_dir, new_dir, err)
+		os.Exit(1)
+	}
+	// Snapshots are kept next to the sandbox, and follow it
+	if common.DirExists(sandbox.SnapshotDir(sandbox_dir)) {
+		err = os.Rename(sandbox.SnapshotDir(sandbox_dir), sandbox.SnapshotDir(new_dir))
+		if err != nil {
+			fmt.Printf("Error moving the snapshots of %s: %s\n", sandbox_dir, err)
+			os.Exit(1)
+		}
+	}
+	sandbox.RelocateSandbox(sandbox_dir, new_dir)
+	common.RemoveFromCatalog(sandbox_dir)
+	new_item := common.SandboxItemFromDir(new_dir)
+	common.UpdateCatalog(new_item)
+	if was_running {
+		StartSandbox(new_item)
+	}
+	fmt.Printf("Sandbox %s moved to %s\n", args[0], new_dir)
+}
+
+var moveCmd = &cobra.Command{
+	Use:   "move sandbox_name new_name_or_path",
+	Short: "Moves a sandbox to a different location",
+	Long: `Moves a sandbox to a different directory.
+If the destination is a simple name, the sandbox is renamed inside
+--sandbox-home. Otherwise, the destination is used as the new path.
+The sandbox is stopped, and its scripts and configuration files are
+written again with the new paths. Its snapshots, if any, are moved
+with it. If the sandbox was running, it is restarted after the move.
+The destination must be in the same file system.`,
+	Example: `
+	$ dbdeployer move msb_5_7_21 msb_reference
+	$ dbdeployer move rsandbox_5_7_21 /data/sandboxes/rsandbox_5_7_21
+`,
+	Run: MoveSandbox,
+}
+
+func init() {
+	rootCmd.AddCommand(moveCmd)
+}
@@ -51,4 +51,5 @@ Use the "unpack" command to get the tarball into the right directory.
 func init() {
 	rootCmd.AddCommand(multipleCmd)
 	multipleCmd.PersistentFlags().IntP("nodes", "n", 3, "How many nodes will be installed")
+	AddUnpackFlags(multipleCmd.PersistentFlags())
 }
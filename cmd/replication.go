@@ -32,10 +32,16 @@ func ReplicationSandbox(cmd *cobra.Command, args []string) {
 	nodes, _ := flags.GetInt("nodes")
 	topology, _ := flags.GetString("topology")
 	sd.SinglePrimary, _ = flags.GetBool("single-primary")
+	sd.Terminology, _ = flags.GetString("terminology")
 	if sd.SinglePrimary && topology != "group" {
 		fmt.Println("Option 'single-primary' can only be used with 'group' topology ")
 		os.Exit(1)
 	}
+	// The nodes of a group are named n1, n2, n3 with any terminology
+	if flags.Changed("terminology") && topology == "group" {
+		fmt.Println("Option 'terminology' can only be used with 'master-slave' topology ")
+		os.Exit(1)
+	}
 	sandbox.CreateReplicationSandbox(sd, args[0], topology, nodes)
 }
 
@@ -60,6 +66,9 @@ Use the "unpack" command to get the tarball into the right directory.
 
 		$ dbdeployer --topology=group replication 5.7.21
 		$ dbdeployer --topology=group replication 8.0.4 --single-primary
+
+		$ dbdeployer replication 8.0.23 --terminology=new
+		# (scripts are named src, r1, r2, initialize_replicas, check_replicas)
 	`,
 }
 
@@ -68,5 +77,7 @@ func init() {
 	replicationCmd.PersistentFlags().StringP("topology", "t", "master-slave", "Which topology will be installed")
 	replicationCmd.PersistentFlags().IntP("nodes", "n", 3, "How many nodes will be installed")
 	replicationCmd.PersistentFlags().BoolP("single-primary", "", false, "Using single primary for group replication")
+	replicationCmd.PersistentFlags().String("terminology", sandbox.LegacyTerminology, "Names of replication scripts: 'legacy' (m, s1, check_slaves) or 'new' (src, r1, check_replicas), for master-slave only")
+	AddUnpackFlags(replicationCmd.PersistentFlags())
 	//replicationCmd.PersistentFlags().Int("slaves",  2, "How many slaves will be installed")
 }
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/datacharmer/dbdeployer/common"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -34,7 +35,7 @@ Runs single, multiple, and replicated sandboxes.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
-	Version: versionDef,
+	Version: common.VersionDef,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
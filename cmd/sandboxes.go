@@ -15,132 +15,149 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
+	"os"
+	"sort"
 
 	"github.com/datacharmer/dbdeployer/common"
 	"github.com/spf13/cobra"
-	"io/ioutil"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
 )
 
+// A catalog entry, with its status when requested
+type sandbox_listing struct {
+	common.SandboxItem `yaml:",inline"`
+	Status             string `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
 func GetInstalledPorts(sandbox_home string) []int {
-	files, err := ioutil.ReadDir(sandbox_home)
-	if err != nil {
-		log.Fatal(err)
-	}
-	var port_collection []int
-	for _, f := range files {
-		fname := f.Name()
-		fmode := f.Mode()
-		if fmode.IsDir() {
-			sbdesc := sandbox_home + "/" + fname + "/sbdescription.json"
-			if common.FileExists(sbdesc) {
-				sbd := common.ReadSandboxDescription(sandbox_home + "/" + fname)
-				if sbd.Nodes == 0 {
-					for _, p := range sbd.Port {
-						port_collection = append(port_collection, p)
-					}
-				} else {
-					var node_descr []common.SandboxDescription
-					if common.DirExists(sandbox_home + "/" + fname + "/master") {
-						sd_master := common.ReadSandboxDescription(sandbox_home + "/" + fname + "/master")
-						node_descr = append(node_descr, sd_master)
-					}
-					for node := 1; node <= sbd.Nodes; node++ {
-						sd_node := common.ReadSandboxDescription(fmt.Sprintf("%s/%s/node%d", sandbox_home, fname, node))
-						node_descr = append(node_descr, sd_node)
-					}
-					for _, nd := range node_descr {
-						for _, p := range nd.Port {
-							port_collection = append(port_collection, p)
-						}
-					}
-				}
-			}
-		}
+	return common.CatalogPorts(sandbox_home)
+}
+
+// Reads the sandbox filters (--version, --type, --name) from the command line
+func GetSandboxFilter(cmd *cobra.Command) common.SandboxFilter {
+	flags := cmd.Flags()
+	version, _ := flags.GetString("version")
+	sb_type, _ := flags.GetString("type")
+	name_pattern, _ := flags.GetString("name")
+	return common.SandboxFilter{
+		Version:     version,
+		SBType:      sb_type,
+		NamePattern: name_pattern,
 	}
-	return port_collection
+}
+
+// Adds the sandbox filters to a set of flags
+func AddSandboxFilterFlags(flags *pflag.FlagSet) {
+	flags.String("version", "", "Only sandboxes of this version (5.7.21) or series (5.7)")
+	flags.String("type", "", "Only sandboxes of this type (single, multiple, master-slave, group)")
+	flags.String("name", "", "Only sandboxes with a name matching this pattern (e.g. 'msb_5_7*')")
 }
 
 // Shows installed sandboxes
 func ShowSandboxes(cmd *cobra.Command, args []string) {
 	flags := cmd.Flags()
 	SandboxHome, _ := flags.GetString("sandbox-home")
-	files, err := ioutil.ReadDir(SandboxHome)
-	if err != nil {
-		log.Fatal(err)
+	output, _ := flags.GetString("output")
+	header, _ := flags.GetBool("header")
+	with_status, _ := flags.GetBool("status")
+
+	var listing []sandbox_listing
+	// Sandboxes without a description are not in the catalog
+	items := append(common.CatalogItems(SandboxHome), common.ScanUndescribedSandboxes(SandboxHome)...)
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	for _, sb := range common.FilterSandboxes(items, GetSandboxFilter(cmd)) {
+		item := sandbox_listing{SandboxItem: sb}
+		if with_status && sb.Version != "" {
+			item.Status = common.SandboxStatus(sb)
+		}
+		listing = append(listing, item)
 	}
-	var dirs []string
-	for _, f := range files {
-		fname := f.Name()
-		fmode := f.Mode()
-		if fmode.IsDir() {
-			description := "single"
-			sbdesc := SandboxHome + "/" + fname + "/sbdescription.json"
-			if common.FileExists(sbdesc) {
-				sbd := common.ReadSandboxDescription(SandboxHome + "/" + fname)
-				if sbd.Nodes == 0 {
-					port_text := ""
-					for _, p := range sbd.Port {
-						if port_text != "" {
-							port_text += " "
-						}
-						port_text += fmt.Sprintf("%d", p)
-					}
-					description = fmt.Sprintf("%-20s %10s [%s]", sbd.SBType, sbd.Version, port_text)
-				} else {
-					var node_descr []common.SandboxDescription
-					if common.DirExists(SandboxHome + "/" + fname + "/master") {
-						sd_master := common.ReadSandboxDescription(SandboxHome + "/" + fname + "/master")
-						node_descr = append(node_descr, sd_master)
-					}
-					for node := 1; node <= sbd.Nodes; node++ {
-						sd_node := common.ReadSandboxDescription(fmt.Sprintf("%s/%s/node%d", SandboxHome, fname, node))
-						node_descr = append(node_descr, sd_node)
-					}
-					ports := ""
-					for _, nd := range node_descr {
-						for _, p := range nd.Port {
-							if ports != "" {
-								ports += " "
-							}
-							ports += fmt.Sprintf("%d", p)
-						}
-					}
-					//ports += " ]"
-					description = fmt.Sprintf("%-20s %10s [%s]", sbd.SBType, sbd.Version, ports)
-				}
-				dirs = append(dirs, fmt.Sprintf("%-20s : %s", fname, description))
-			} else {
-				start := SandboxHome + "/" + fname + "/start"
-				start_all := SandboxHome + "/" + fname + "/start_all"
-				initialize_slaves := SandboxHome + "/" + fname + "/initialize_slaves"
-				initialize_nodes := SandboxHome + "/" + fname + "/initialize_nodes"
-				if common.FileExists(start_all) {
-					description = "multiple sandbox"
-				}
-				if common.FileExists(initialize_slaves) {
-					description = "master-slave replication"
-				}
-				if common.FileExists(initialize_nodes) {
-					description = "group replication"
-				}
-				if common.FileExists(start) || common.FileExists(start_all) {
-					dirs = append(dirs, fmt.Sprintf("%-20s : %s", fname, description))
-				}
-			}
+	switch output {
+	case "json":
+		if listing == nil {
+			listing = []sandbox_listing{}
 		}
+		b, err := json.MarshalIndent(listing, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding sandbox list: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(b))
+	case "yaml":
+		if listing == nil {
+			listing = []sandbox_listing{}
+		}
+		b, err := yaml.Marshal(listing)
+		if err != nil {
+			fmt.Printf("Error encoding sandbox list: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(string(b))
+	case "table":
+		show_sandbox_table(listing, header, with_status)
+	default:
+		fmt.Printf("Unknown output format '%s'. Use one of: table, json, yaml\n", output)
+		os.Exit(1)
 	}
-	for _, dir := range dirs {
-		fmt.Println(dir)
+}
+
+func show_sandbox_table(listing []sandbox_listing, header, with_status bool) {
+	if header {
+		title := fmt.Sprintf("%-20s : %-20s %10s %s", "name", "type", "version", "ports")
+		if with_status {
+			title += "  status"
+		}
+		fmt.Println(title)
+		fmt.Printf("%-20s : %-20s %10s %s\n", "----", "----", "-------", "-----")
+	}
+	for _, sb := range listing {
+		if sb.Version == "" {
+			// A sandbox without description, known only by its type
+			fmt.Printf("%-20s : %s\n", sb.Name, sb.SBType)
+			continue
+		}
+		port_text := ""
+		for _, p := range sb.Port {
+			if port_text != "" {
+				port_text += " "
+			}
+			port_text += fmt.Sprintf("%d", p)
+		}
+		description := fmt.Sprintf("%-20s %10s [%s]", sb.SBType, sb.Version, port_text)
+		if sb.Locked {
+			description += " (LOCKED)"
+		}
+		if with_status {
+			description += "  " + sb.Status
+		}
+		fmt.Printf("%-20s : %s\n", sb.Name, description)
 	}
 }
 
 // sandboxesCmd represents the sandboxes command
 var sandboxesCmd = &cobra.Command{
-	Use:     "sandboxes",
-	Short:   "List installed sandboxes",
-	Long:    ``,
+	Use:   "sandboxes",
+	Short: "List installed sandboxes",
+	Long: `Lists the sandboxes deployed in --sandbox-home.
+The list comes from the sandbox catalog ($HOME/.dbdeployer/sandboxes.json),
+which is updated at every deployment and deletion.
+Sandboxes found in --sandbox-home but missing from the catalog are
+added to it. Sandboxes without a description (sbdescription.json)
+are listed with their type only.
+If the catalog gets out of sync, run 'dbdeployer catalog rebuild'.
+
+The list can be printed as a table (default), or as JSON or YAML
+for use in scripts:
+	$ dbdeployer sandboxes --output=json
+	$ dbdeployer sandboxes --header --status
+The --status flag checks whether the servers in each sandbox are running,
+and reports "running", "stopped", or "partially running".
+The list can be restricted using --version, --type, and --name:
+	$ dbdeployer sandboxes --version=5.7 --type=master-slave
+	$ dbdeployer sandboxes --name='msb_*'`,
 	Aliases: []string{"installed", "deployed"},
 	Run:     ShowSandboxes,
 }
@@ -148,5 +165,8 @@ var sandboxesCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(sandboxesCmd)
 
-	// sandboxesCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	sandboxesCmd.Flags().String("output", "table", "Output format: table, json, yaml")
+	sandboxesCmd.Flags().Bool("header", false, "Shows a header line in table output")
+	sandboxesCmd.Flags().Bool("status", false, "Shows whether the sandbox servers are running")
+	AddSandboxFilterFlags(sandboxesCmd.Flags())
 }
@@ -18,9 +18,14 @@ import (
 	"fmt"
 	"github.com/datacharmer/dbdeployer/common"
 	"github.com/datacharmer/dbdeployer/sandbox"
+	"github.com/datacharmer/dbdeployer/unpack"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"strings"
 )
 
 func replace_template(template_name string, file_name string) {
@@ -56,6 +61,30 @@ func check_template_change_request(request string) (template_name, file_name str
 	return
 }
 
+// Detects the version of the binaries in a base directory given as
+// a path, such as an installed server or the output of a source build.
+func full_dir_origin(origin string) (basedir, version string) {
+	basedir, err := filepath.Abs(origin)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if !common.DirExists(basedir) {
+		fmt.Printf("Base directory %s does not exist\n", basedir)
+		os.Exit(1)
+	}
+	if !common.ExecExists(basedir + "/bin/mysqld") {
+		fmt.Printf("Server %s/bin/mysqld not found\n", basedir)
+		os.Exit(1)
+	}
+	version, _ = common.VersionFromBasedir(basedir)
+	if version == "" {
+		fmt.Printf("Could not detect the version of the server in %s\n", basedir)
+		os.Exit(1)
+	}
+	return basedir, version
+}
+
 func FillSdef(cmd *cobra.Command, args []string) sandbox.SandboxDef {
 	var sd sandbox.SandboxDef
 
@@ -66,7 +95,33 @@ func FillSdef(cmd *cobra.Command, args []string) sandbox.SandboxDef {
 		tname, fname := check_template_change_request(request)
 		replace_template(tname, fname)
 	}
-	sd.Port = sandbox.VersionToPort(args[0])
+	sd.Version = args[0]
+	sd.Basedir, _ = flags.GetString("sandbox-binary")
+	// A tarball is unpacked into --sandbox-binary, unless it was
+	// unpacked already. A path, rather than a version, is the directory
+	// of the binaries.
+	if unpack.ArchiveBaseName(path.Base(args[0])) != "" {
+		if !common.FileExists(args[0]) {
+			fmt.Printf("Tarball %s not found\n", args[0])
+			os.Exit(1)
+		}
+		sd.Version = unpack_tarball(cmd, args[0], true)
+	} else {
+		for _, name := range unpack_flag_names {
+			if flags.Changed(name) {
+				fmt.Printf("--%s can only be used when deploying from a tarball\n", name)
+				os.Exit(1)
+			}
+		}
+		if strings.Contains(args[0], "/") {
+			sd.Basedir, sd.Version = full_dir_origin(args[0])
+			sd.FullBasedir = true
+		}
+	}
+	// The flavor, with the version, decides which features the
+	// sandbox can use (see sandbox.Capabilities)
+	sd.Flavor = common.DetectFlavor(sandbox.SandboxBasedir(sd))
+	sd.Port = sandbox.VersionToPort(sd.Version)
 
 	sd.UserPort, _ = flags.GetInt("port")
 	sd.BasePort, _ = flags.GetInt("base-port")
@@ -75,8 +130,6 @@ func FillSdef(cmd *cobra.Command, args []string) sandbox.SandboxDef {
 		sd.Port = sd.UserPort
 	}
 
-	sd.Version = args[0]
-	sd.Basedir, _ = flags.GetString("sandbox-binary")
 	sd.SandboxDir, _ = flags.GetString("sandbox-home")
 	sd.InstalledPorts = GetInstalledPorts(sd.SandboxDir)
 	// fmt.Printf("%v\n", installed_ports)
@@ -91,6 +144,11 @@ func FillSdef(cmd *cobra.Command, args []string) sandbox.SandboxDef {
 	sd.InitOptions, _ = flags.GetStringSlice("init-options")
 	sd.MyCnfOptions, _ = flags.GetStringSlice("my-cnf-options")
 	sd.KeepAuthPlugin, _ = flags.GetBool("keep-auth-plugin")
+	sd.CommandLine = strings.Join(os.Args, " ")
+	sd.Flags = []string{}
+	flags.Visit(func(f *pflag.Flag) {
+		sd.Flags = append(sd.Flags, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+	})
 
 	var gtid bool
 	var master bool
@@ -101,12 +159,16 @@ func FillSdef(cmd *cobra.Command, args []string) sandbox.SandboxDef {
 		sd.ServerId = sd.Port
 	}
 	if gtid {
-		if sandbox.GreaterOrEqualVersion(sd.Version, []int{5, 6, 9}) {
+		if sandbox.HasCapability(sd.Flavor, sandbox.MySQLGtid, sd.Version) {
 			sd.GtidOptions = sandbox.GtidOptions
 			sd.ReplOptions = sandbox.ReplOptions
 			sd.ServerId = sd.Port
+		} else if sandbox.HasCapability(sd.Flavor, sandbox.MariaDBGtid, sd.Version) {
+			sd.GtidOptions = sandbox.MariaDBGtidOptions
+			sd.ReplOptions = sandbox.ReplOptions
+			sd.ServerId = sd.Port
 		} else {
-			fmt.Println("--gtid requires version 5.6.9+")
+			fmt.Printf("--gtid requires MySQL or Percona Server 5.6.9+, or MariaDB 10.0.2+ (found %s %s)\n", sd.Flavor, sd.Version)
 			os.Exit(1)
 		}
 	}
@@ -125,7 +187,7 @@ func SingleSandbox(cmd *cobra.Command, args []string) {
 
 // singleCmd represents the single command
 var singleCmd = &cobra.Command{
-	Use: "single MySQL-Version",
+	Use: "single MySQL-Version-or-basedir",
 	// Args:  cobra.ExactArgs(1),
 	Short: "deploys a single sandbox",
 	Long: `single installs a sandbox and creates useful scripts for its use.
@@ -138,6 +200,19 @@ For example:
 For this command to work, there must be a directory $HOME/opt/mysql/5.7.21, containing
 the binary files from mysql-5.7.21-$YOUR_OS-x86_64.tar.gz
 Use the "unpack" command to get the tarball into the right directory.
+Instead of a version, you can give the path of a directory containing
+the binaries, such as an installed server or the output of a source
+build. The version and flavor are detected from bin/mysqld --version,
+and the sandbox is named after them:
+	dbdeployer single /usr/local/mysql-8.0.11
+You can also give a tarball, which is unpacked into --sandbox-binary
+unless that version was unpacked already:
+	dbdeployer single mysql-5.7.21-linux-glibc2.12-x86_64.tar.gz
+The options of "unpack" (--unpack-version, --prefix, --checksum,
+--checksum-file, --slim, --slim-exclude) apply to the tarball.
+When the version was unpacked already, --checksum and the slim options
+must match the ones recorded in its dbdeployer_tarball.json.
+The same applies to the "multiple" and "replication" commands.
 `,
 	Run: SingleSandbox,
 }
@@ -145,6 +220,7 @@ Use the "unpack" command to get the tarball into the right directory.
 func init() {
 	rootCmd.AddCommand(singleCmd)
 	singleCmd.PersistentFlags().Bool("master", false, "Make the server replication ready")
+	AddUnpackFlags(singleCmd.PersistentFlags())
 
 }
 
@@ -0,0 +1,200 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/sandbox"
+	"github.com/spf13/cobra"
+)
+
+func check_snapshot_name(name string) {
+	if !regexp.MustCompile(`^[\w.-]+$`).MatchString(name) {
+		fmt.Printf("Invalid snapshot name '%s': only letters, digits, '_', '.', and '-' are allowed\n", name)
+		os.Exit(1)
+	}
+}
+
+func get_snapshot(sandbox_dir, name string) {
+	check_snapshot_name(name)
+	if !sandbox.SnapshotExists(sandbox_dir, name) {
+		fmt.Printf("Snapshot '%s' not found in %s\n", name, sandbox.SnapshotDir(sandbox_dir))
+		fmt.Println("You can run 'dbdeployer snapshot list' for a list of available snapshots")
+		os.Exit(1)
+	}
+}
+
+func TakeSnapshot(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Sandbox name required.")
+		os.Exit(1)
+	}
+	sandbox_dir := GetSandboxDir(cmd, args[0])
+	name := time.Now().Format("20060102-150405")
+	if len(args) > 1 {
+		name = args[1]
+	}
+	check_snapshot_name(name)
+	if sandbox.SnapshotExists(sandbox_dir, name) {
+		fmt.Printf("Snapshot '%s' already exists for sandbox %s\n", name, args[0])
+		os.Exit(1)
+	}
+	item := common.SandboxItemFromDir(sandbox_dir)
+	var gtids map[string]string
+	if common.SandboxStatus(item) == common.StatusRunning {
+		gtids = sandbox.SandboxGtidState(sandbox_dir)
+	}
+	// The data directories are only consistent while the servers are stopped
+	was_running := StopSandbox(item)
+	snapshot, err := sandbox.TakeSnapshot(sandbox_dir, name, gtids)
+	if was_running {
+		StartSandbox(item)
+	}
+	if err != nil {
+		fmt.Printf("Error creating snapshot '%s': %s\n", name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Snapshot '%s' of %s created (%d bytes)\n", snapshot.Name, args[0], snapshot.Size)
+}
+
+func RestoreSnapshot(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Println("Sandbox name and snapshot name required.")
+		os.Exit(1)
+	}
+	sandbox_dir := GetSandboxDir(cmd, args[0])
+	get_snapshot(sandbox_dir, args[1])
+	if common.IsSandboxLocked(sandbox_dir) {
+		fmt.Printf("Sandbox %s is locked. Run 'dbdeployer admin unlock %s' before restoring\n", args[0], args[0])
+		os.Exit(1)
+	}
+	// After an upgrade, the servers can't start from the older data
+	snapshot := sandbox.ReadSnapshot(sandbox_dir, args[1])
+	sbd := common.ReadSandboxDescription(sandbox_dir)
+	if snapshot.Version != sbd.Version {
+		fmt.Printf("Snapshot '%s' was taken with version %s, but sandbox %s now runs %s\n", args[1], snapshot.Version, args[0], sbd.Version)
+		os.Exit(1)
+	}
+	item := common.SandboxItemFromDir(sandbox_dir)
+	was_running := StopSandbox(item)
+	err := sandbox.RestoreSnapshot(sandbox_dir, args[1])
+	if err != nil {
+		fmt.Printf("Error restoring snapshot '%s': %s\n", args[1], err)
+		fmt.Println("The previous data was left in place")
+		os.Exit(1)
+	}
+	if was_running {
+		StartSandbox(item)
+	}
+	fmt.Printf("Sandbox %s restored to snapshot '%s'\n", args[0], args[1])
+}
+
+func ListSnapshots(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Sandbox name required.")
+		os.Exit(1)
+	}
+	sandbox_dir := GetSandboxDir(cmd, args[0])
+	for _, snapshot := range sandbox.ListSnapshots(sandbox_dir) {
+		fmt.Printf("%-20s %-25s %-8s %12d\n", snapshot.Name, snapshot.Timestamp, snapshot.Version, snapshot.Size)
+		for _, node := range snapshot.Nodes {
+			if node.GtidExecuted != "" {
+				fmt.Printf("    %-10s %s\n", node.Name, node.GtidExecuted)
+			}
+		}
+	}
+}
+
+func DeleteSnapshot(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Println("Sandbox name and snapshot name required.")
+		os.Exit(1)
+	}
+	sandbox_dir := GetSandboxDir(cmd, args[0])
+	get_snapshot(sandbox_dir, args[1])
+	err := sandbox.DeleteSnapshot(sandbox_dir, args[1])
+	if err != nil {
+		fmt.Printf("Error removing snapshot '%s': %s\n", args[1], err)
+		os.Exit(1)
+	}
+	fmt.Printf("Snapshot '%s' of %s removed\n", args[1], args[0])
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manages the snapshots of a sandbox",
+	Long: `Creates, lists, and removes snapshots of the data of a sandbox.
+Use "dbdeployer restore" to bring the sandbox back to a snapshot.`,
+	Example: `
+	$ dbdeployer snapshot create msb_5_7_21 before_test1
+	$ dbdeployer snapshot list msb_5_7_21
+	$ dbdeployer restore msb_5_7_21 before_test1
+	$ dbdeployer snapshot delete msb_5_7_21 before_test1
+`,
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create sandbox_name [snapshot_name]",
+	Short: "Creates a snapshot of a sandbox",
+	Long: `Creates a compressed archive of the data directories of a sandbox.
+The sandbox is stopped while the archive is created, and restarted
+afterwards. If the sandbox was running, the GTID state of each server
+is recorded with the snapshot.
+Snapshots are stored in a directory next to the sandbox, named after
+it with the suffix ".snapshots". Without a name, the snapshot is named
+after the current time.
+Use "dbdeployer restore" to bring the sandbox back to a snapshot.`,
+	Example: `
+	$ dbdeployer snapshot create msb_5_7_21
+	$ dbdeployer snapshot create rsandbox_5_7_21 before_test1
+`,
+	Run: TakeSnapshot,
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list sandbox_name",
+	Short: "Lists the snapshots of a sandbox",
+	Long:  `Shows name, time, version, size, and GTID state of the snapshots of a sandbox.`,
+	Run:   ListSnapshots,
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete sandbox_name snapshot_name",
+	Short: "Removes a snapshot",
+	Run:   DeleteSnapshot,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore sandbox_name snapshot_name",
+	Short: "Brings a sandbox back to a snapshot",
+	Long: `Replaces the data directories of a sandbox with the ones saved in a snapshot.
+The sandbox is stopped during the operation, and restarted afterwards
+if it was running. Locked sandboxes can't be restored, and neither can
+snapshots taken before the sandbox was upgraded to another version.`,
+	Run: RestoreSnapshot,
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(restoreCmd)
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+}
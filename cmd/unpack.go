@@ -16,17 +16,43 @@ package cmd
 
 import (
 	"fmt"
+	"hash"
+	"io/ioutil"
 	"os"
+	"os/signal"
 	"path"
 	"strings"
+	"syscall"
 
 	"github.com/datacharmer/dbdeployer/common"
 	"github.com/datacharmer/dbdeployer/sandbox"
 	"github.com/datacharmer/dbdeployer/unpack"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+// Options of unpack, also accepted by the commands that deploy
+// directly from a tarball.
+var unpack_flag_names = []string{"unpack-version", "checksum", "checksum-file", "slim", "slim-exclude", "prefix"}
+
+func AddUnpackFlags(flags *pflag.FlagSet) {
+	flags.String("unpack-version", "", "which version is contained in the tarball (detected from the tarball name or the binaries when not given)")
+	flags.String("checksum", "", "Checksum that the tarball must match (sha256:hex, sha1:hex, md5:hex)")
+	flags.String("checksum-file", "", "File containing the checksum of the tarball (e.g. the output of sha256sum)")
+	flags.Bool("slim", false, "Skip test suite, debug binaries, and static libraries")
+	flags.StringSlice("slim-exclude", unpack.SlimExcludePatterns, "Patterns of entries skipped by --slim (implies --slim)")
+	flags.String("prefix", "", "Prefix for the final expanded directory (default: based on the flavor)")
+}
+
 func UnpackTarball(cmd *cobra.Command, args []string) {
+	unpack_tarball(cmd, args[0], false)
+}
+
+// Unpacks a tarball into --sandbox-binary, and returns the name of the
+// expanded directory, such as 5.7.21 or ps5.7.21.
+// With reuse, a directory that exists already for the same version
+// is used instead of failing.
+func unpack_tarball(cmd *cobra.Command, tarball string, reuse bool) string {
 	flags := cmd.Flags()
 	Basedir, _ := flags.GetString("sandbox-binary")
 	if !common.DirExists(Basedir) {
@@ -34,69 +60,276 @@ func UnpackTarball(cmd *cobra.Command, args []string) {
 		fmt.Println("You should create it or provide an alternate base directory using --sandbox-binary")
 		os.Exit(1)
 	}
+	barename := unpack.ArchiveBaseName(path.Base(tarball))
+	if barename == "" {
+		fmt.Printf("Tarball or package extension must be one of %s\n", strings.Join(unpack.ValidSuffixes, " "))
+		os.Exit(1)
+	}
 
+	// Version and flavor are taken from the name of the tarball,
+	// unless --unpack-version and --prefix are given.
 	Version, _ := flags.GetString("unpack-version")
 	if Version == "" {
-		fmt.Println("unpack: flag --unpack-version is mandatory")
-		os.Exit(1)
+		Version = common.VersionFromText(barename)
+	}
+	flavor := common.FlavorFromText(barename)
+	checksum := get_unpack_checksum(cmd, tarball)
+	var exclude []string
+	slim, _ := flags.GetBool("slim")
+	if slim || flags.Changed("slim-exclude") {
+		exclude, _ = flags.GetStringSlice("slim-exclude")
+	}
+	if Version != "" {
+		name := unpack_prefix(cmd, flavor) + Version
+		if reuse && common.DirExists(Basedir+"/"+name) {
+			err := check_reused_unpack(Basedir+"/"+name, checksum, exclude)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Printf("Using %s/%s, unpacked already\n", Basedir, name)
+			return name
+		}
+		err := check_unpack_destination(Basedir, unpack_prefix(cmd, flavor), Version)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
-	// This call used to ensure that the port provided is in the right format
-	sandbox.VersionToPort(Version)
-	Prefix, _ := flags.GetString("prefix")
-	tarball := args[0]
 
-	destination := Basedir + "/" + Prefix + Version
-	if common.DirExists(destination) {
-		fmt.Printf("Destination directory %s exists already\n", destination)
+	// The tarball is extracted in a temporary directory, which is
+	// renamed to the final destination only when the extraction
+	// succeeds. It is removed on failure or interruption.
+	temp_dir, err := ioutil.TempDir(Basedir, ".unpack_")
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	var extension string = ".tar.gz"
-	extracted := path.Base(tarball)
-	var barename string
-	if strings.HasSuffix(tarball, extension) {
-		barename = extracted[0 : len(extracted)-len(extension)]
-	} else {
-		fmt.Println("Tarball extension must be .tar.gz")
+	abort := func(format string, a ...interface{}) {
+		os.RemoveAll(temp_dir)
+		fmt.Printf(format, a...)
 		os.Exit(1)
 	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		abort("\nUnpacking interrupted by %s\n", sig)
+	}()
 
-	fmt.Printf("Unpacking tarball %s to %s\n", tarball, destination)
+	fmt.Printf("Unpacking tarball %s to %s\n", tarball, Basedir)
 	verbosity_level := unpack.VERBOSE
-	err := unpack.UnpackTar(tarball, Basedir, verbosity_level)
+	var hasher hash.Hash
+	if checksum != nil {
+		hasher = checksum.NewHash()
+	}
+	saved, err := unpack.UnpackTarExcluding(tarball, temp_dir, verbosity_level, hasher, exclude)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		abort("%s\n", err)
+	}
+	// The extracted files reach the destination only if the checksum matches
+	if checksum != nil {
+		if !checksum.Matches(hasher) {
+			abort("Checksum mismatch for %s\nexpected: %s\nfound:    %s:%x\n",
+				tarball, checksum, checksum.Algorithm, hasher.Sum(nil))
+		}
+		fmt.Printf("Checksum verified (%s)\n", checksum.Algorithm)
+	}
+	// Packages install under usr/, and their files are moved
+	// to the layout of a tarball.
+	extracted := temp_dir
+	if unpack.IsPackage(tarball) {
+		err = unpack.ArrangePackageLayout(temp_dir)
+	} else {
+		extracted, err = unpack.TopLevelDir(temp_dir)
+	}
+	if err != nil {
+		abort("%s\n", err)
+	}
+	if Version == "" && extracted != temp_dir {
+		Version = common.VersionFromText(path.Base(extracted))
 	}
-	final_name := Basedir + "/" + barename
-	if final_name != destination {
-		err = os.Rename(final_name, destination)
+	if Version == "" || flavor == "" {
+		detected_version, detected_flavor := common.VersionFromBasedir(extracted)
+		if Version == "" {
+			Version = detected_version
+		}
+		if flavor == "" {
+			flavor = detected_flavor
+		}
+	}
+	if Version == "" {
+		abort("Could not detect the version of the binaries in %s\nUse --unpack-version to set it\n", tarball)
+	}
+	name := unpack_prefix(cmd, flavor) + Version
+	destination := Basedir + "/" + name
+	if reuse && common.DirExists(destination) {
+		err = check_reused_unpack(destination, checksum, exclude)
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			abort("%s\n", err)
+		}
+		signal.Stop(signals)
+		os.RemoveAll(temp_dir)
+		fmt.Printf("Using %s, unpacked already\n", destination)
+		return name
+	}
+	err = check_unpack_destination(Basedir, unpack_prefix(cmd, flavor), Version)
+	if err != nil {
+		abort("%s\n", err)
+	}
+	info := common.TarballInfo{
+		Tarball: path.Base(tarball),
+		Version: Version,
+		Flavor:  flavor,
+	}
+	if checksum != nil {
+		info.Checksum = checksum.String()
+	}
+	info.Excluded = exclude
+	err = common.WriteTarballInfo(extracted, info)
+	if err != nil {
+		abort("%s\n", err)
+	}
+	err = os.Rename(extracted, destination)
+	if err != nil {
+		abort("%s\n", err)
+	}
+	signal.Stop(signals)
+	os.RemoveAll(temp_dir)
+	if flavor == "" {
+		flavor = "unknown"
+	}
+	fmt.Printf("Version %s (flavor: %s) unpacked to %s\n", Version, flavor, destination)
+	if len(exclude) > 0 {
+		fmt.Printf("Slim unpack: %.1f MB saved (excluded: %s)\n", float64(saved)/(1024*1024), strings.Join(exclude, " "))
+	}
+	return name
+}
+
+// Checks that a directory unpacked already can be used in place of
+// a tarball: the checksum and the slim options given for the tarball
+// must be the ones recorded when the directory was unpacked.
+func check_reused_unpack(destination string, checksum *common.Checksum, exclude []string) error {
+	if checksum == nil && len(exclude) == 0 {
+		return nil
+	}
+	info, err := common.ReadTarballInfo(destination)
+	if err != nil {
+		return fmt.Errorf("%s exists already, and its origin can't be verified: %s", destination, err)
+	}
+	if checksum != nil && info.Checksum != checksum.String() {
+		recorded := info.Checksum
+		if recorded == "" {
+			recorded = "none"
 		}
+		return fmt.Errorf("%s exists already, with a different checksum\nexpected: %s\nrecorded: %s", destination, checksum, recorded)
 	}
+	if len(exclude) > 0 && strings.Join(exclude, " ") != strings.Join(info.Excluded, " ") {
+		if len(info.Excluded) == 0 {
+			return fmt.Errorf("%s exists already, and was not unpacked with --slim", destination)
+		}
+		return fmt.Errorf("%s exists already, unpacked with different slim options (excluded: %s)", destination, strings.Join(info.Excluded, " "))
+	}
+	return nil
+}
+
+// Returns the checksum that the tarball must match, from --checksum
+// or --checksum-file, or nil if none was given.
+func get_unpack_checksum(cmd *cobra.Command, tarball string) *common.Checksum {
+	flags := cmd.Flags()
+	checksum_text, _ := flags.GetString("checksum")
+	checksum_file, _ := flags.GetString("checksum-file")
+	if checksum_text != "" && checksum_file != "" {
+		fmt.Println("Only one of --checksum and --checksum-file can be used")
+		os.Exit(1)
+	}
+	var checksum common.Checksum
+	var err error
+	switch {
+	case checksum_text != "":
+		checksum, err = common.ParseChecksum(checksum_text)
+	case checksum_file != "":
+		checksum, err = common.ReadChecksumFile(checksum_file, tarball)
+	default:
+		return nil
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return &checksum
+}
+
+// Returns the prefix for the expanded directory: the one given
+// with --prefix, or the default one for the flavor.
+func unpack_prefix(cmd *cobra.Command, flavor string) string {
+	if cmd.Flags().Changed("prefix") {
+		prefix, _ := cmd.Flags().GetString("prefix")
+		return prefix
+	}
+	return common.FlavorPrefixes[flavor]
+}
+
+func check_unpack_destination(basedir, prefix, version string) error {
+	// This call used to ensure that the port provided is in the right format
+	if sandbox.VersionToPort(version) < 0 {
+		return fmt.Errorf("Invalid version %s", version)
+	}
+	destination := basedir + "/" + prefix + version
+	if common.DirExists(destination) {
+		return fmt.Errorf("Destination directory %s exists already", destination)
+	}
+	return nil
 }
 
 // unpackCmd represents the unpack command
 var unpackCmd = &cobra.Command{
-	Use:   "unpack MySQL-tarball",
+	Use:   "unpack MySQL-tarball-or-package",
 	Args:  cobra.ExactArgs(1),
 	Short: "unpack a tarball into the binary directory",
 	Long: `If you want to create a sandbox from a tarball, you first need to unpack it
 into the sandbox-binary directory. This command carries out that task, so that afterwards 
 you can call 'single', 'multiple', and 'replication' commands with only the MySQL version
-for that tarball.`,
+for that tarball.
+Tarballs can be compressed with gzip, bzip2, xz, or zstd. The compression
+is detected from the contents of the file.
+The version is detected from the tarball name or, failing that, from the
+expanded binaries. Use --unpack-version to override it.
+The flavor (mysql, percona, mariadb) is detected at the same time, and
+determines the default prefix of the expanded directory: none for MySQL,
+"ps" for Percona Server, "ma" for MariaDB.
+The tarball is extracted in a temporary directory under --sandbox-binary,
+which is renamed to the final destination only when the extraction is
+complete. The top directory of the tarball can have any name.
+With --checksum or --checksum-file, the tarball is verified (md5, sha1,
+or sha256) while it is being read, and nothing is installed if the
+checksum does not match. The unpacked directory contains a file
+dbdeployer_tarball.json with the origin of the binaries and the
+verified checksum.
+With --slim, the test suite, debug binaries, and static libraries are
+not extracted. The list of skipped entries can be changed with
+--slim-exclude: a pattern matches any part of the path of an entry,
+and a matching directory is skipped with all its contents.
+Server packages (.deb and .rpm) are accepted as well. Their files are
+rearranged into the layout of a tarball: usr/sbin and usr/bin go to
+bin/, the server libraries and plugins to lib/, and usr/share/mysql to
+share/. Note that a server package may not include the client programs.`,
 	Run: UnpackTarball,
 	Example: `
-    $ dbdeployer --unpack-version=8.0.4 unpack mysql-8.0.4-rc-linux-glibc2.12-x86_64.tar.gz
-    Unpacking tarball mysql-8.0.4-rc-linux-glibc2.12-x86_64.tar.gz to $HOME/opt/mysql/8.0.4
+    $ dbdeployer unpack mysql-8.0.4-rc-linux-glibc2.12-x86_64.tar.gz
+    Unpacking tarball mysql-8.0.4-rc-linux-glibc2.12-x86_64.tar.gz to $HOME/opt/mysql
     .........100.........200.........292
+    Version 8.0.4 (flavor: mysql) unpacked to $HOME/opt/mysql/8.0.4
+
+    $ dbdeployer unpack Percona-Server-5.7.21-20-Linux.x86_64.ssl100.tar.gz
+    [...]
+    Version 5.7.21 (flavor: percona) unpacked to $HOME/opt/mysql/ps5.7.21
+
+    $ dbdeployer unpack mysql-8.0.11-linux-glibc2.12-x86_64.tar.xz
 	`,
 }
 
 func init() {
 	rootCmd.AddCommand(unpackCmd)
-
-	unpackCmd.PersistentFlags().String("unpack-version", "", "which version is contained in the tarball (mandatory)")
-	unpackCmd.PersistentFlags().String("prefix", "", "Prefix for the final expanded directory")
+	AddUnpackFlags(unpackCmd.PersistentFlags())
 }
@@ -0,0 +1,107 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/sandbox"
+	"github.com/spf13/cobra"
+)
+
+func UpgradeSandbox(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Println("Sandbox name and new version required.")
+		os.Exit(1)
+	}
+	sandbox_binary, _ := cmd.Flags().GetString("sandbox-binary")
+	sandbox_dir := GetSandboxDir(cmd, args[0])
+	new_version := args[1]
+	new_basedir := sandbox_binary + "/" + new_version
+	// As for deployment, a path is the directory of the binaries
+	if strings.Contains(args[1], "/") {
+		new_basedir, new_version = full_dir_origin(args[1])
+	}
+	new_version_list := sandbox.VersionToList(new_version)
+	if new_version_list[0] < 0 {
+		os.Exit(1)
+	}
+	if !common.DirExists(new_basedir) {
+		fmt.Printf("Base directory %s does not exist\n", new_basedir)
+		os.Exit(1)
+	}
+	sbd := common.ReadSandboxDescription(sandbox_dir)
+	// The data directory of one flavor can't be upgraded by another
+	old_flavor := common.SandboxFlavor(sbd.Flavor, sbd.Version, sbd.Basedir)
+	new_flavor := common.DetectFlavor(new_basedir)
+	if old_flavor != new_flavor {
+		fmt.Printf("Sandbox %s is %s %s: can't upgrade to %s %s\n", args[0], old_flavor, sbd.Version, new_flavor, new_version)
+		os.Exit(1)
+	}
+	if sandbox.GreaterOrEqualVersion(sbd.Version, new_version_list) {
+		fmt.Printf("Sandbox %s is already at version %s: can't upgrade to %s\n", args[0], sbd.Version, new_version)
+		os.Exit(1)
+	}
+	item := common.SandboxItemFromDir(sandbox_dir)
+	check_template_data(item)
+
+	was_running := StopSandbox(item)
+	err := sandbox.UpgradeSandbox(sandbox_dir, new_version, new_basedir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	new_item := common.SandboxItemFromDir(sandbox_dir)
+	common.UpdateCatalog(new_item)
+	if was_running {
+		StartSandbox(new_item)
+		if common.FileExists(sandbox_dir + "/initialize_nodes") {
+			common.Run_cmd(sandbox_dir + "/initialize_nodes")
+		}
+	}
+	fmt.Printf("Sandbox %s upgraded from %s to %s\n", args[0], sbd.Version, new_version)
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade sandbox_name new_version_or_basedir",
+	Short: "Upgrades a sandbox to a newer version",
+	Long: `Upgrades the servers of a sandbox to a newer version, found in --sandbox-binary.
+The sandbox is stopped, and each server, slaves before master, gets its
+scripts written again for the new version (including grants and
+authentication options), and is started on the new binaries to upgrade
+its data directory. Versions before 8.0.16 run mysql_upgrade, while
+later ones upgrade the data directory automatically.
+The new version must be of the same flavor (MySQL, Percona Server,
+MariaDB) as the sandbox.
+The sandbox keeps its name and its ports, and is restarted if it was
+running.
+Instead of a version, you can give the path of a directory containing
+the binaries, as for the "single" command.
+If the upgrade of a server fails, the upgrade stops, and reports the
+servers that were upgraded. Running it again upgrades the remaining ones.`,
+	Example: `
+	$ dbdeployer upgrade msb_5_7_21 8.0.11
+	$ dbdeployer upgrade rsandbox_5_7_19 5.7.21
+	$ dbdeployer upgrade msb_5_7_21 /usr/local/mysql-8.0.11
+`,
+	Run: UpgradeSandbox,
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+}
@@ -47,6 +47,7 @@ Example:
 
 "./clear" stops the server and removes everything from the data directory, 
 letting you ready to start from scratch. (Warning! It's irreversible!)
+A sandbox locked with "dbdeployer admin lock" refuses to run "./clear".
 `
 	const multiple_usage string = ` USING MULTIPLE SERVER SANDBOX
 On a replication sandbox, you have the same commands (run "dbdeployer usage single"), 
@@ -67,6 +68,10 @@ m
 s1, s2, n1, n2
 
 The scripts "check_slaves" or "check_nodes" give the status of replication in the sandbox.
+
+When the replication sandbox is deployed with "--terminology=new", the scripts
+use the source/replica names: "./src", "./r1", "./r2", "initialize_replicas",
+and "check_replicas".
 `
 	request := ""
 	if len(args) > 0 {
@@ -74,12 +79,12 @@ The scripts "check_slaves" or "check_nodes" give the status of replication in th
 	}
 	switch request {
 	case "single":
-		fmt.Println(basic_usage)
+		fmt.Printf("%s\n", basic_usage)
 	case "multiple":
-		fmt.Println(multiple_usage)
+		fmt.Printf("%s\n", multiple_usage)
 	default:
-		fmt.Println(basic_usage)
-		fmt.Println(multiple_usage)
+		fmt.Printf("%s\n", basic_usage)
+		fmt.Printf("%s\n", multiple_usage)
 	}
 }
 
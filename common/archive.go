@@ -0,0 +1,99 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+func add_to_tar(writer *tar.Writer, base_dir, file_path string, info os.FileInfo) error {
+	name, err := filepath.Rel(base_dir, file_path)
+	if err != nil {
+		return err
+	}
+	mode := info.Mode()
+	link := ""
+	switch {
+	case mode&os.ModeSymlink != 0:
+		link, err = os.Readlink(file_path)
+		if err != nil {
+			return err
+		}
+	case mode.IsDir(), mode.IsRegular():
+	default:
+		// Sockets, devices, and pipes can't be restored
+		return nil
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+	if mode.IsDir() {
+		header.Name += "/"
+	}
+	err = writer.WriteHeader(header)
+	if err != nil || !mode.IsRegular() {
+		return err
+	}
+	file, err := os.Open(file_path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// Creates a compressed tar archive containing the given entries.
+// Entries are files or directories relative to base_dir, and are
+// stored in the archive with their relative names.
+func CreateTarGz(filename, base_dir string, entries []string) error {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	compressor := gzip.NewWriter(file)
+	writer := tar.NewWriter(compressor)
+	for _, entry := range entries {
+		err = filepath.Walk(filepath.Join(base_dir, entry), func(file_path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return add_to_tar(writer, base_dir, file_path, info)
+		})
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = compressor.Close()
+	}
+	close_err := file.Close()
+	if err == nil {
+		err = close_err
+	}
+	if err != nil {
+		os.Remove(filename)
+	}
+	return err
+}
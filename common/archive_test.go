@@ -0,0 +1,83 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCreateTarGz(t *testing.T) {
+	base_dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base_dir)
+	os.MkdirAll(base_dir+"/node1/data/mysql", 0755)
+	os.MkdirAll(base_dir+"/node2/data", 0755)
+	WriteString("one", base_dir+"/node1/data/mysql/user.frm")
+	WriteString("two", base_dir+"/node2/data/ibdata1")
+	WriteString("not archived", base_dir+"/node1/start")
+
+	archive := base_dir + "/snapshot.tar.gz"
+	err = CreateTarGz(archive, base_dir, []string{"node1/data", "node2/data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, _ := os.Open(archive)
+	defer file.Close()
+	decompressor, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := tar.NewReader(decompressor)
+	found := make(map[string]bool)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		found[header.Name] = true
+	}
+	var expected_list = []struct {
+		name     string
+		expected bool
+	}{
+		{"node1/data/", true},
+		{"node1/data/mysql/", true},
+		{"node1/data/mysql/user.frm", true},
+		{"node2/data/ibdata1", true},
+		{"node1/start", false},
+	}
+	for _, item := range expected_list {
+		if found[item.name] == item.expected {
+			t.Logf("ok     %-30s %v\n", item.name, found[item.name])
+		} else {
+			t.Logf("NOT OK %-30s %v (expected %v)\n", item.name, found[item.name], item.expected)
+			t.Fail()
+		}
+	}
+	if CreateTarGz(archive, base_dir, []string{"node1/data"}) == nil {
+		t.Logf("NOT OK existing archive was overwritten\n")
+		t.Fail()
+	}
+}
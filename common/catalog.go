@@ -0,0 +1,354 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// A catalog entry describes one deployment: a single sandbox,
+// or a group of nodes (multiple, replication, group.)
+type SandboxItem struct {
+	Name        string   `json:"name" yaml:"name"`
+	SBType      string   `json:"type" yaml:"type"`
+	Version     string   `json:"version" yaml:"version"`
+	Port        []int    `json:"port" yaml:"port"`
+	Nodes       []string `json:"nodes" yaml:"nodes"`
+	Destination string   `json:"destination" yaml:"destination"`
+	Locked      bool     `json:"locked" yaml:"locked"`
+}
+
+// Marker file of a locked sandbox. Its presence disables
+// the "clear" scripts and the "delete" command.
+const SandboxLockFile string = "no_clear"
+
+// The catalog is indexed by the full path of each deployment
+type SandboxCatalog map[string]SandboxItem
+
+var (
+	ConfigurationDir   string = os.Getenv("HOME") + "/.dbdeployer"
+	SandboxCatalogFile string = ConfigurationDir + "/sandboxes.json"
+	catalog_lock_file  string = ConfigurationDir + "/sandboxes.lock"
+)
+
+// Returns the absolute and clean version of a sandbox path,
+// so that the same sandbox is always recorded under the same key.
+func catalog_key(destination string) string {
+	full_path, err := filepath.Abs(destination)
+	if err != nil {
+		return filepath.Clean(destination)
+	}
+	return full_path
+}
+
+// Acquires a lock on the catalog. The lock is exclusive when
+// the catalog is going to be modified, and shared otherwise.
+// The returned file must be passed to unlock_catalog.
+func lock_catalog(exclusive bool) *os.File {
+	if !DirExists(ConfigurationDir) {
+		err := os.MkdirAll(ConfigurationDir, 0755)
+		if err != nil {
+			fmt.Printf("Error creating directory %s: %s\n", ConfigurationDir, err)
+			os.Exit(1)
+		}
+	}
+	lock, err := os.OpenFile(catalog_lock_file, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		fmt.Printf("Error opening lock file %s: %s\n", catalog_lock_file, err)
+		os.Exit(1)
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	err = syscall.Flock(int(lock.Fd()), how)
+	if err != nil {
+		fmt.Printf("Error locking %s: %s\n", catalog_lock_file, err)
+		os.Exit(1)
+	}
+	return lock
+}
+
+func unlock_catalog(lock *os.File) {
+	syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+	lock.Close()
+}
+
+// Reads the catalog file. Must be called while holding the lock.
+func read_catalog() SandboxCatalog {
+	catalog := make(SandboxCatalog)
+	if !FileExists(SandboxCatalogFile) {
+		return catalog
+	}
+	blob := SlurpAsBytes(SandboxCatalogFile)
+	if len(blob) == 0 {
+		return catalog
+	}
+	err := json.Unmarshal(blob, &catalog)
+	if err != nil {
+		fmt.Printf("Error decoding sandbox catalog %s: %s\n", SandboxCatalogFile, err)
+		fmt.Println("You can regenerate it with 'dbdeployer catalog rebuild'")
+		os.Exit(1)
+	}
+	return catalog
+}
+
+// Writes the catalog file. Must be called while holding the lock.
+// The contents go to a temporary file first, which then replaces
+// the catalog, so that readers never see a partial file.
+func write_catalog(catalog SandboxCatalog) {
+	b, err := json.MarshalIndent(catalog, " ", "\t")
+	if err != nil {
+		fmt.Println("error encoding sandbox catalog: ", err)
+		os.Exit(1)
+	}
+	tmp_file := SandboxCatalogFile + ".tmp"
+	err = WriteString(string(b), tmp_file)
+	if err == nil {
+		err = os.Rename(tmp_file, SandboxCatalogFile)
+	}
+	if err != nil {
+		fmt.Printf("Error writing sandbox catalog %s: %s\n", SandboxCatalogFile, err)
+		os.Exit(1)
+	}
+}
+
+func CatalogExists() bool {
+	return FileExists(SandboxCatalogFile)
+}
+
+// Returns the contents of the catalog
+func ReadCatalog() SandboxCatalog {
+	lock := lock_catalog(false)
+	defer unlock_catalog(lock)
+	return read_catalog()
+}
+
+// Adds or replaces a deployment in the catalog
+func UpdateCatalog(item SandboxItem) {
+	item.Destination = catalog_key(item.Destination)
+	lock := lock_catalog(true)
+	defer unlock_catalog(lock)
+	catalog := read_catalog()
+	catalog[item.Destination] = item
+	write_catalog(catalog)
+}
+
+// Removes a deployment from the catalog
+func RemoveFromCatalog(destination string) {
+	lock := lock_catalog(true)
+	defer unlock_catalog(lock)
+	catalog := read_catalog()
+	delete(catalog, catalog_key(destination))
+	write_catalog(catalog)
+}
+
+// Regenerates the catalog entries for the given sandbox home,
+// using the sandbox description files found in its directories.
+// Entries for other sandbox homes are kept, unless their
+// directory no longer exists.
+func RebuildCatalog(sandbox_home string) SandboxCatalog {
+	sandbox_home = catalog_key(sandbox_home)
+	lock := lock_catalog(true)
+	defer unlock_catalog(lock)
+	catalog := read_catalog()
+	for destination, _ := range catalog {
+		if path.Dir(destination) == sandbox_home || !DirExists(destination) {
+			delete(catalog, destination)
+		}
+	}
+	for _, item := range ScanSandboxes(sandbox_home) {
+		catalog[item.Destination] = item
+	}
+	write_catalog(catalog)
+	return catalog
+}
+
+// Returns the catalog, after adding the sandboxes of the given sandbox
+// home that are not recorded yet, such as the ones deployed by an older
+// dbdeployer, or in a sandbox home that was never scanned.
+func catalog_with_sandbox_home(sandbox_home string) SandboxCatalog {
+	catalog := ReadCatalog()
+	var missing []SandboxItem
+	for _, item := range ScanSandboxes(sandbox_home) {
+		if _, ok := catalog[item.Destination]; !ok {
+			missing = append(missing, item)
+		}
+	}
+	if len(missing) == 0 {
+		return catalog
+	}
+	lock := lock_catalog(true)
+	defer unlock_catalog(lock)
+	catalog = read_catalog()
+	for _, item := range missing {
+		catalog[item.Destination] = item
+	}
+	write_catalog(catalog)
+	return catalog
+}
+
+// Returns the deployments in the catalog that belong to the given
+// sandbox home, sorted by name.
+// Sandboxes found in the sandbox home but missing from the catalog
+// are added to it.
+func CatalogItems(sandbox_home string) []SandboxItem {
+	catalog := catalog_with_sandbox_home(sandbox_home)
+	sandbox_home = catalog_key(sandbox_home)
+	var items []SandboxItem
+	for destination, item := range catalog {
+		if path.Dir(destination) == sandbox_home && DirExists(destination) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items
+}
+
+// Returns the ports used by all the deployments in the catalog,
+// regardless of their sandbox home, including the ones found in
+// the given sandbox home but missing from the catalog.
+func CatalogPorts(sandbox_home string) []int {
+	var port_collection []int
+	for destination, item := range catalog_with_sandbox_home(sandbox_home) {
+		if !DirExists(destination) {
+			continue
+		}
+		for _, p := range item.Port {
+			port_collection = append(port_collection, p)
+		}
+	}
+	return port_collection
+}
+
+// Builds a catalog entry from the description files of a sandbox
+func SandboxItemFromDir(sandbox_dir string) SandboxItem {
+	sandbox_dir = catalog_key(sandbox_dir)
+	sbd := ReadSandboxDescription(sandbox_dir)
+	item := SandboxItem{
+		Name:        path.Base(sandbox_dir),
+		SBType:      sbd.SBType,
+		Version:     sbd.Version,
+		Port:        []int{},
+		Nodes:       []string{},
+		Destination: sandbox_dir,
+		Locked:      IsSandboxLocked(sandbox_dir),
+	}
+	if sbd.Nodes == 0 {
+		for _, p := range sbd.Port {
+			item.Port = append(item.Port, p)
+		}
+		return item
+	}
+	var node_names []string
+	if DirExists(sandbox_dir + "/master") {
+		node_names = append(node_names, "master")
+	}
+	for node := 1; node <= sbd.Nodes; node++ {
+		node_names = append(node_names, fmt.Sprintf("node%d", node))
+	}
+	for _, node_name := range node_names {
+		node_dir := sandbox_dir + "/" + node_name
+		if !FileExists(node_dir + "/sbdescription.json") {
+			continue
+		}
+		item.Nodes = append(item.Nodes, node_name)
+		nd := ReadSandboxDescription(node_dir)
+		for _, p := range nd.Port {
+			item.Port = append(item.Port, p)
+		}
+	}
+	return item
+}
+
+// Looks for deployments in the sandbox home, by checking
+// the directories that contain a sandbox description.
+func ScanSandboxes(sandbox_home string) []SandboxItem {
+	var items []SandboxItem
+	files, err := ioutil.ReadDir(sandbox_home)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return items
+		}
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, f := range files {
+		fname := f.Name()
+		if !f.Mode().IsDir() || strings.HasPrefix(fname, ".") {
+			continue
+		}
+		sandbox_dir := sandbox_home + "/" + fname
+		if FileExists(sandbox_dir + "/sbdescription.json") {
+			items = append(items, SandboxItemFromDir(sandbox_dir))
+		}
+	}
+	return items
+}
+
+// Returns the sandboxes of the given sandbox home that have no
+// sandbox description, such as the ones deployed by the first versions
+// of dbdeployer. Their type is guessed from their scripts, and they
+// have no version and no ports.
+func ScanUndescribedSandboxes(sandbox_home string) []SandboxItem {
+	var items []SandboxItem
+	files, err := ioutil.ReadDir(sandbox_home)
+	if err != nil {
+		return items
+	}
+	for _, f := range files {
+		fname := f.Name()
+		if !f.Mode().IsDir() || strings.HasPrefix(fname, ".") {
+			continue
+		}
+		sandbox_dir := sandbox_home + "/" + fname
+		if FileExists(sandbox_dir + "/sbdescription.json") {
+			continue
+		}
+		description := "single"
+		if FileExists(sandbox_dir + "/start_all") {
+			description = "multiple sandbox"
+		}
+		if FileExists(sandbox_dir + "/initialize_slaves") {
+			description = "master-slave replication"
+		}
+		if FileExists(sandbox_dir + "/initialize_nodes") {
+			description = "group replication"
+		}
+		if FileExists(sandbox_dir+"/start") || FileExists(sandbox_dir+"/start_all") {
+			items = append(items, SandboxItem{
+				Name:        fname,
+				SBType:      description,
+				Port:        []int{},
+				Nodes:       []string{},
+				Destination: catalog_key(sandbox_dir),
+				Locked:      IsSandboxLocked(sandbox_dir),
+			})
+		}
+	}
+	return items
+}
+
+func IsSandboxLocked(sandbox_dir string) bool {
+	return FileExists(sandbox_dir + "/" + SandboxLockFile)
+}
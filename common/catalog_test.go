@@ -0,0 +1,63 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+)
+
+// Sandboxes that are not in the catalog, such as the ones deployed by
+// an older dbdeployer, must still count for the ports in use.
+func TestCatalogPortsWithMissingSandboxes(t *testing.T) {
+	work_dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(work_dir)
+	saved_dir, saved_file, saved_lock := ConfigurationDir, SandboxCatalogFile, catalog_lock_file
+	defer func() {
+		ConfigurationDir, SandboxCatalogFile, catalog_lock_file = saved_dir, saved_file, saved_lock
+	}()
+	ConfigurationDir = work_dir + "/.dbdeployer"
+	SandboxCatalogFile = ConfigurationDir + "/sandboxes.json"
+	catalog_lock_file = ConfigurationDir + "/sandboxes.lock"
+
+	sandbox_home := work_dir + "/sandboxes"
+	for name, description := range map[string]string{
+		"msb_5_7_21": `{"type":"single","version":"5.7.21","port":[5721],"nodes":0}`,
+		"msb_8_0_11": `{"type":"single","version":"8.0.11","port":[8011],"nodes":0}`,
+	} {
+		os.MkdirAll(sandbox_home+"/"+name, 0755)
+		WriteString(description, sandbox_home+"/"+name+"/sbdescription.json")
+	}
+	// A sandbox without description is listed, but has no ports
+	os.MkdirAll(sandbox_home+"/rsandbox_5_6_30", 0755)
+	WriteString("", sandbox_home+"/rsandbox_5_6_30/start_all")
+	WriteString("", sandbox_home+"/rsandbox_5_6_30/initialize_slaves")
+
+	// The catalog exists, but knows only one of the sandboxes
+	UpdateCatalog(SandboxItemFromDir(sandbox_home + "/msb_5_7_21"))
+
+	ports := CatalogPorts(sandbox_home)
+	sort.Ints(ports)
+	if len(ports) == 2 && ports[0] == 5721 && ports[1] == 8011 {
+		t.Logf("ok     ports %v\n", ports)
+	} else {
+		t.Logf("NOT OK ports %v (expected: [5721 8011])\n", ports)
+		t.Fail()
+	}
+	if _, ok := ReadCatalog()[catalog_key(sandbox_home+"/msb_8_0_11")]; ok {
+		t.Logf("ok     missing sandbox added to the catalog\n")
+	} else {
+		t.Logf("NOT OK missing sandbox not added to the catalog\n")
+		t.Fail()
+	}
+	undescribed := ScanUndescribedSandboxes(sandbox_home)
+	if len(undescribed) == 1 && undescribed[0].SBType == "master-slave replication" {
+		t.Logf("ok     sandbox without description: %s\n", undescribed[0].SBType)
+	} else {
+		t.Logf("NOT OK sandboxes without description: %v\n", undescribed)
+		t.Fail()
+	}
+}
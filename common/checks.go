@@ -3,25 +3,17 @@ package common
 import (
 	"fmt"
 	"os"
-	"strings"
 )
 
 func CheckOrigin(args []string) {
 	if len(args) < 1 {
-		fmt.Println("This command requires the MySQL version (x.xx.xx) as argument ")
+		fmt.Println("This command requires the MySQL version (x.xx.xx), a base directory, or a tarball as argument ")
 		os.Exit(1)
 	}
 	if len(args) > 1 {
-		fmt.Println("Extra argument detected. This command requires only the MySQL version (x.xx.xx) as argument ")
+		fmt.Println("Extra argument detected. This command requires only the MySQL version (x.xx.xx), a base directory, or a tarball as argument ")
 		os.Exit(1)
 	}
-	origin := args[0]
-	if FileExists(origin) && strings.HasSuffix(origin, ".tar.gz") {
-		fmt.Println("Tarball detected. - If you want to use a tarball to create a sandbox,")
-		fmt.Println("you should first use the 'unpack' command")
-		os.Exit(1)
-	}
-
 }
 
 func CheckSandboxDir(sandbox_home string) {
@@ -0,0 +1,136 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// A checksum in the format "algorithm:hex_digest"
+type Checksum struct {
+	Algorithm string
+	Value     string
+}
+
+// Length of the hexadecimal digest of each supported algorithm
+var checksum_lengths = map[string]int{
+	"md5":    32,
+	"sha1":   40,
+	"sha256": 64,
+}
+
+func (c Checksum) String() string {
+	return c.Algorithm + ":" + c.Value
+}
+
+func (c Checksum) NewHash() hash.Hash {
+	switch c.Algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	}
+	return sha256.New()
+}
+
+// Compares the checksum with the result of a hash
+func (c Checksum) Matches(h hash.Hash) bool {
+	return hex.EncodeToString(h.Sum(nil)) == c.Value
+}
+
+// Parses a checksum given as "algorithm:hex_digest" or as a bare
+// digest, in which case the algorithm is deduced from its length.
+func ParseChecksum(text string) (Checksum, error) {
+	var checksum Checksum
+	text = strings.TrimSpace(text)
+	colon := strings.Index(text, ":")
+	if colon >= 0 {
+		checksum.Algorithm = strings.ToLower(text[:colon])
+		text = text[colon+1:]
+	}
+	checksum.Value = strings.ToLower(text)
+	if !regexp.MustCompile(`^[0-9a-f]+$`).MatchString(checksum.Value) {
+		return checksum, fmt.Errorf("checksum '%s' is not a hexadecimal digest", text)
+	}
+	if checksum.Algorithm == "" {
+		for algorithm, length := range checksum_lengths {
+			if len(checksum.Value) == length {
+				checksum.Algorithm = algorithm
+			}
+		}
+		if checksum.Algorithm == "" {
+			return checksum, fmt.Errorf("can't deduce the algorithm of checksum '%s'", text)
+		}
+	}
+	length, ok := checksum_lengths[checksum.Algorithm]
+	if !ok {
+		return checksum, fmt.Errorf("unsupported checksum algorithm '%s' (use md5, sha1, or sha256)", checksum.Algorithm)
+	}
+	if len(checksum.Value) != length {
+		return checksum, fmt.Errorf("a %s checksum must have %d hexadecimal digits", checksum.Algorithm, length)
+	}
+	return checksum, nil
+}
+
+// Reads the checksum of a tarball from a checksum file, such as the
+// output of sha256sum ("digest  file_name") or a file containing only
+// the digest. When the file lists several tarballs, the line for the
+// given one is used, while a single digest is used regardless of
+// the name. The algorithm is deduced from the suffix of
+// the file (.md5, .sha1, .sha256) or from the length of the digest.
+func ReadChecksumFile(filename, tarball string) (Checksum, error) {
+	if !FileExists(filename) {
+		return Checksum{}, fmt.Errorf("checksum file %s not found", filename)
+	}
+	algorithm := ""
+	for candidate := range checksum_lengths {
+		if strings.HasSuffix(strings.ToLower(filename), "."+candidate) {
+			algorithm = candidate
+		}
+	}
+	var digests []string
+	digest := ""
+	for _, line := range SlurpAsLines(filename) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		digests = append(digests, fields[0])
+		// sha256sum marks binary files with a '*' before the name
+		name := path.Base(strings.TrimPrefix(fields[len(fields)-1], "*"))
+		if len(fields) > 1 && name == path.Base(tarball) {
+			digest = fields[0]
+			break
+		}
+	}
+	if digest == "" && len(digests) == 1 {
+		digest = digests[0]
+	}
+	if digest == "" {
+		return Checksum{}, fmt.Errorf("no checksum for %s found in %s", path.Base(tarball), filename)
+	}
+	if algorithm != "" {
+		digest = algorithm + ":" + digest
+	}
+	return ParseChecksum(digest)
+}
@@ -0,0 +1,101 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const (
+	test_md5    = "d41d8cd98f00b204e9800998ecf8427e"
+	test_sha1   = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	test_sha256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func TestParseChecksum(t *testing.T) {
+	var checksum_list = []struct {
+		text     string
+		expected string
+	}{
+		{"sha256:" + test_sha256, "sha256:" + test_sha256},
+		{"SHA1:" + test_sha1, "sha1:" + test_sha1},
+		{test_md5, "md5:" + test_md5},
+		{test_sha256, "sha256:" + test_sha256},
+		{"md5:" + test_sha1, ""},
+		{"sha512:" + test_sha256, ""},
+		{"sha256:not-a-digest", ""},
+		{"abcdef", ""},
+	}
+	for _, item := range checksum_list {
+		checksum, err := ParseChecksum(item.text)
+		found := ""
+		if err == nil {
+			found = checksum.String()
+		}
+		if found == item.expected {
+			t.Logf("ok     %-20.20s %s\n", item.text, found)
+		} else {
+			t.Logf("NOT OK %-20.20s %s (expected: %s) %v\n", item.text, found, item.expected, err)
+			t.Fail()
+		}
+	}
+	// The checksum of an empty input
+	for _, text := range []string{test_md5, test_sha1, test_sha256} {
+		checksum, _ := ParseChecksum(text)
+		if checksum.Matches(checksum.NewHash()) {
+			t.Logf("ok     %s matches\n", checksum.Algorithm)
+		} else {
+			t.Logf("NOT OK %s does not match\n", checksum.Algorithm)
+			t.Fail()
+		}
+	}
+}
+
+func TestReadChecksumFile(t *testing.T) {
+	work_dir, err := ioutil.TempDir("", "checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(work_dir)
+	tarball := "/some/path/mysql-8.0.11.tar.gz"
+	var file_list = []struct {
+		name     string
+		contents string
+		expected string
+	}{
+		{"SHA256SUMS", test_md5 + "  other.tar.gz\n" + test_sha256 + " *mysql-8.0.11.tar.gz\n", "sha256:" + test_sha256},
+		{"mysql-8.0.11.tar.gz.md5", test_md5 + "\n", "md5:" + test_md5},
+		{"renamed.sha1", test_sha1 + "  mysql-8.0.11-linux.tar.gz\n", "sha1:" + test_sha1},
+		{"wrong_suffix.md5", test_sha256 + "\n", ""},
+		{"missing", test_md5 + "  a.tar.gz\n" + test_sha1 + "  b.tar.gz\n", ""},
+	}
+	for _, item := range file_list {
+		filename := work_dir + "/" + item.name
+		ioutil.WriteFile(filename, []byte(item.contents), 0644)
+		checksum, err := ReadChecksumFile(filename, tarball)
+		found := ""
+		if err == nil {
+			found = checksum.String()
+		}
+		if found == item.expected {
+			t.Logf("ok     %-25s %s\n", item.name, found)
+		} else {
+			t.Logf("NOT OK %-25s %s (expected: %s) %v\n", item.name, found, item.expected, err)
+			t.Fail()
+		}
+	}
+}
@@ -17,44 +17,14 @@ package common
 import (
 	"bufio"
 	"bytes"
-	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 )
 
-type SandboxDescription struct {
-	Basedir string `json:"basedir"`
-	SBType  string `json:"type"` // single multi master-slave group
-	Version string `json:"version"`
-	Port    []int  `json:"port"`
-	Nodes   int    `json:"nodes"`
-}
-
-func WriteSandboxDescription(destination string, sd SandboxDescription) {
-	b, err := json.MarshalIndent(sd, " ", "\t")
-	if err != nil {
-		fmt.Println("error encoding sandbox description: ", err)
-		os.Exit(1)
-	}
-	json_string := fmt.Sprintf("%s", b)
-	filename := destination + "/sbdescription.json"
-	WriteString(json_string, filename)
-}
-
-func ReadSandboxDescription(sandbox_directory string) (sd SandboxDescription) {
-	filename := sandbox_directory + "/sbdescription.json"
-	sb_blob := SlurpAsBytes(filename)
-
-	err := json.Unmarshal(sb_blob, &sd)
-	if err != nil {
-		fmt.Println("error decoding sandbox description: ", err)
-		os.Exit(1)
-	}
-	return
-}
-
 func SlurpAsLines(filename string) []string {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -155,6 +125,14 @@ func Run_cmd_with_args(c string, args []string) error {
 	return err
 }
 
+// Runs a command and returns its standard output and error combined,
+// without printing anything
+func Run_cmd_output(c string, args []string) (string, error) {
+	cmd := exec.Command(c, args...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
 func Run_cmd_ctrl(c string, silent bool) error {
 	//cmd := exec.Command(c, args...)
 	cmd := exec.Command(c, "")
@@ -180,3 +158,51 @@ func Run_cmd_ctrl(c string, silent bool) error {
 func Run_cmd(c string) error {
 	return Run_cmd_ctrl(c, false)
 }
+
+func copy_file(source, destination string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Copies a directory tree, preserving permissions and symbolic links.
+// The destination must not exist.
+// Special files (sockets, devices, pipes) are skipped.
+func CopyDir(source, destination string) error {
+	return filepath.Walk(source, func(file_path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(source, file_path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relative)
+		mode := info.Mode()
+		switch {
+		case mode.IsDir():
+			return os.Mkdir(target, mode.Perm())
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(file_path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case mode.IsRegular():
+			return copy_file(file_path, target, mode.Perm())
+		}
+		return nil
+	})
+}
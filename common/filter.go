@@ -0,0 +1,130 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Criteria to select sandboxes from the catalog.
+// Empty fields match everything.
+type SandboxFilter struct {
+	Version     string // "5.7.21", or a partial version such as "5.7"
+	SBType      string // "single", "multiple", "master-slave", or "group"
+	NamePattern string // shell pattern, such as "msb_5_7*"
+}
+
+const (
+	StatusRunning = "running"
+	StatusStopped = "stopped"
+	StatusPartial = "partially running"
+)
+
+func (filter SandboxFilter) Matches(item SandboxItem) bool {
+	if filter.Version != "" {
+		if item.Version != filter.Version && !strings.HasPrefix(item.Version, filter.Version+".") {
+			return false
+		}
+	}
+	if filter.SBType != "" {
+		// "group" matches both single and multi primary group replication
+		if item.SBType != filter.SBType && !strings.HasPrefix(item.SBType, filter.SBType+"-") {
+			return false
+		}
+	}
+	if filter.NamePattern != "" {
+		matches, err := path.Match(filter.NamePattern, item.Name)
+		if err != nil {
+			fmt.Printf("Invalid name pattern '%s': %s\n", filter.NamePattern, err)
+			os.Exit(1)
+		}
+		if !matches {
+			return false
+		}
+	}
+	return true
+}
+
+func FilterSandboxes(items []SandboxItem, filter SandboxFilter) []SandboxItem {
+	var selected []SandboxItem
+	for _, item := range items {
+		if filter.Matches(item) {
+			selected = append(selected, item)
+		}
+	}
+	return selected
+}
+
+// Returns the directories of the database servers in a deployment.
+// For a single sandbox, it is the sandbox directory itself.
+func NodeDirs(item SandboxItem) []string {
+	if len(item.Nodes) == 0 {
+		return []string{item.Destination}
+	}
+	var dirs []string
+	for _, node := range item.Nodes {
+		dirs = append(dirs, item.Destination+"/"+node)
+	}
+	return dirs
+}
+
+// Checks whether the server in a sandbox directory is running,
+// using its pid file and the process it points to.
+func IsNodeRunning(node_dir string) bool {
+	pid_files, _ := filepath.Glob(node_dir + "/data/mysql_sandbox*.pid")
+	for _, pid_file := range pid_files {
+		contents, err := ioutil.ReadFile(pid_file)
+		if err != nil {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+		if err != nil || pid <= 0 {
+			continue
+		}
+		// Signal 0 checks for the existence of the process
+		// without affecting it
+		err = syscall.Kill(pid, 0)
+		if err == nil || err == syscall.EPERM {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns "running", "stopped", or "partially running", depending
+// on how many of the nodes in the deployment are running.
+func SandboxStatus(item SandboxItem) string {
+	running := 0
+	node_dirs := NodeDirs(item)
+	for _, node_dir := range node_dirs {
+		if IsNodeRunning(node_dir) {
+			running++
+		}
+	}
+	switch running {
+	case 0:
+		return StatusStopped
+	case len(node_dirs):
+		return StatusRunning
+	}
+	return StatusPartial
+}
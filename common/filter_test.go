@@ -0,0 +1,37 @@
+package common
+
+import "testing"
+
+func TestSandboxFilter(t *testing.T) {
+	t.Parallel()
+	items := []SandboxItem{
+		{Name: "msb_5_7_21", SBType: "single", Version: "5.7.21"},
+		{Name: "msb_5_7_210", SBType: "single", Version: "5.7.210"},
+		{Name: "rsandbox_5_7_21", SBType: "master-slave", Version: "5.7.21"},
+		{Name: "group_msb_8_0_4", SBType: "group-single-primary", Version: "8.0.4"},
+		{Name: "multi_msb_8_0_4", SBType: "multiple", Version: "8.0.4"},
+	}
+	var filter_list = []struct {
+		filter   SandboxFilter
+		expected int
+	}{
+		{SandboxFilter{}, 5},
+		{SandboxFilter{Version: "5.7.21"}, 2},
+		{SandboxFilter{Version: "5.7"}, 3},
+		{SandboxFilter{Version: "5"}, 3},
+		{SandboxFilter{Version: "8.0.4", SBType: "group"}, 1},
+		{SandboxFilter{SBType: "single"}, 2},
+		{SandboxFilter{NamePattern: "msb_*"}, 2},
+		{SandboxFilter{NamePattern: "*msb_8*", SBType: "multiple"}, 1},
+		{SandboxFilter{NamePattern: "none*"}, 0},
+	}
+	for _, fl := range filter_list {
+		selected := FilterSandboxes(items, fl.filter)
+		if len(selected) == fl.expected {
+			t.Logf("ok     %-50v %d\n", fl.filter, len(selected))
+		} else {
+			t.Logf("NOT OK %-50v %d (expected %d)\n", fl.filter, len(selected), fl.expected)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	MySQLFlavor   = "mysql"
+	PerconaFlavor = "percona"
+	MariaDBFlavor = "mariadb"
+)
+
+// Default prefix of the directory where the binaries of each flavor
+// are expanded (e.g. $HOME/opt/mysql/ps5.7.21 for Percona Server.)
+var FlavorPrefixes = map[string]string{
+	MySQLFlavor:   "",
+	PerconaFlavor: "ps",
+	MariaDBFlavor: "ma",
+}
+
+// Returns the flavor mentioned in a text, such as the name of a
+// tarball or the output of "mysqld --version", or an empty string.
+// Percona Server and MariaDB are checked first, as their names may
+// be accompanied by "mysql".
+func FlavorFromText(text string) string {
+	text = strings.ToLower(text)
+	for _, flavor := range []string{PerconaFlavor, MariaDBFlavor, MySQLFlavor} {
+		if strings.Contains(text, flavor) {
+			return flavor
+		}
+	}
+	return ""
+}
+
+// Returns the first version (x.y.z) found in a text, or an empty string.
+// Suffixes such as "-rc" or "-20" are not included.
+func VersionFromText(text string) string {
+	return regexp.MustCompile(`\d+\.\d+\.\d+`).FindString(text)
+}
+
+// Detects version and flavor of the binaries in a base directory,
+// from the output of "bin/mysqld --version", or from docs/INFO_SRC
+// when the server can't run on this host.
+func VersionFromBasedir(basedir string) (version, flavor string) {
+	output, err := Run_cmd_output(basedir+"/bin/mysqld", []string{"--version"})
+	if err == nil {
+		// mysqld  Ver 8.0.4-rc for linux-glibc2.12 on x86_64 (MySQL Community Server (GPL))
+		matches := regexp.MustCompile(`Ver\s+(\d+\.\d+\.\d+)`).FindStringSubmatch(output)
+		if matches != nil {
+			return matches[1], FlavorFromText(output)
+		}
+	}
+	info_src := basedir + "/docs/INFO_SRC"
+	if !FileExists(info_src) {
+		return "", ""
+	}
+	for _, line := range SlurpAsLines(info_src) {
+		lower := strings.ToLower(line)
+		// MySQL source 8.0.4, or version: 5.7.21
+		if strings.Contains(lower, "source") || strings.HasPrefix(lower, "version") {
+			version = VersionFromText(line)
+			if version != "" {
+				return version, FlavorFromText(line)
+			}
+		}
+	}
+	return "", ""
+}
+
+// Files that are found only in the binaries of one flavor
+var flavor_markers = []struct {
+	flavor string
+	file   string
+}{
+	{MariaDBFlavor, "bin/mariadb"},
+	{MariaDBFlavor, "bin/mariadbd"},
+	{MariaDBFlavor, "bin/aria_chk"},
+	{MariaDBFlavor, "README-wsrep"},
+	{PerconaFlavor, "bin/ps-admin"},
+	{PerconaFlavor, "bin/ps_tokudb_admin"},
+	{PerconaFlavor, "bin/ps_mysqld_helper"},
+}
+
+// Detects the flavor of the binaries in a base directory, looking at
+// the version string of the server, at files found only in one flavor,
+// and finally at the prefix of the directory name (e.g. ma10.2.14.)
+// MySQL is assumed when nothing else is found.
+func DetectFlavor(basedir string) string {
+	_, flavor := VersionFromBasedir(basedir)
+	if flavor != "" && flavor != MySQLFlavor {
+		return flavor
+	}
+	for _, marker := range flavor_markers {
+		if FileExists(basedir + "/" + marker.file) {
+			return marker.flavor
+		}
+	}
+	if flavor = FlavorFromPrefix(path.Base(basedir)); flavor != "" {
+		return flavor
+	}
+	return MySQLFlavor
+}
+
+// Returns the flavor indicated by the prefix of a version or of a
+// directory name (e.g. ma10.2.14), or an empty string.
+func FlavorFromPrefix(name string) string {
+	for flavor, prefix := range FlavorPrefixes {
+		if prefix != "" && strings.HasPrefix(name, prefix) && VersionFromText(name) != "" {
+			return flavor
+		}
+	}
+	return ""
+}
+
+// Returns the flavor of a sandbox. Sandboxes deployed before flavors
+// were recorded have none, and their flavor is found from the prefix
+// of their version, or from the binaries in their base directory.
+func SandboxFlavor(flavor, version, basedir string) string {
+	if flavor != "" {
+		return flavor
+	}
+	if flavor = FlavorFromPrefix(version); flavor != "" {
+		return flavor
+	}
+	if basedir != "" {
+		return DetectFlavor(basedir)
+	}
+	return MySQLFlavor
+}
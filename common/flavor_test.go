@@ -0,0 +1,116 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestVersionAndFlavorFromText(t *testing.T) {
+	var text_list = []struct {
+		text    string
+		version string
+		flavor  string
+	}{
+		{"mysql-8.0.4-rc-linux-glibc2.12-x86_64", "8.0.4", MySQLFlavor},
+		{"mysql-5.7.21-macos10.13-x86_64", "5.7.21", MySQLFlavor},
+		{"Percona-Server-5.7.21-20-Linux.x86_64.ssl100", "5.7.21", PerconaFlavor},
+		{"mariadb-10.2.14-linux-x86_64", "10.2.14", MariaDBFlavor},
+		{"mysqld  Ver 10.2.14-MariaDB for Linux on x86_64 (MariaDB Server)", "10.2.14", MariaDBFlavor},
+		{"mysqld  Ver 5.7.21-20 for Linux on x86_64 (Percona Server (GPL), Release 20)", "5.7.21", PerconaFlavor},
+		{"MySQL source 8.0.11", "8.0.11", MySQLFlavor},
+		{"binaries-5.7", "", ""},
+	}
+	for _, item := range text_list {
+		version := VersionFromText(item.text)
+		flavor := FlavorFromText(item.text)
+		if version == item.version && flavor == item.flavor {
+			t.Logf("ok     %-45s %-8s %s\n", item.text, version, flavor)
+		} else {
+			t.Logf("NOT OK %-45s %-8s %s (expected: %s %s)\n", item.text, version, flavor, item.version, item.flavor)
+			t.Fail()
+		}
+	}
+}
+
+func TestDetectFlavor(t *testing.T) {
+	work_dir, err := ioutil.TempDir("", "flavor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(work_dir)
+	var basedir_list = []struct {
+		dir      string
+		files    []string
+		expected string
+	}{
+		{"10.3.7", []string{"bin/mariadbd", "bin/mysqld"}, MariaDBFlavor},
+		{"5.7.21", []string{"bin/ps-admin", "bin/mysqld"}, PerconaFlavor},
+		{"ps8.0.11", []string{"bin/mysqld"}, PerconaFlavor},
+		{"ma10.2.14", []string{"bin/mysqld"}, MariaDBFlavor},
+		{"8.0.11", []string{"bin/mysqld"}, MySQLFlavor},
+		{"mysql-build", []string{"docs/INFO_SRC"}, MySQLFlavor},
+	}
+	for _, item := range basedir_list {
+		basedir := work_dir + "/" + item.dir
+		for _, file := range item.files {
+			os.MkdirAll(path.Dir(basedir+"/"+file), 0755)
+			// The files are not executable: the detection can't rely on mysqld
+			ioutil.WriteFile(basedir+"/"+file, []byte(""), 0644)
+		}
+		flavor := DetectFlavor(basedir)
+		if flavor == item.expected {
+			t.Logf("ok     %-12s %s\n", item.dir, flavor)
+		} else {
+			t.Logf("NOT OK %-12s %s (expected: %s)\n", item.dir, flavor, item.expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestSandboxFlavor(t *testing.T) {
+	work_dir, err := ioutil.TempDir("", "flavor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(work_dir)
+	os.MkdirAll(work_dir+"/10.3.7/bin", 0755)
+	ioutil.WriteFile(work_dir+"/10.3.7/bin/mariadbd", []byte(""), 0644)
+	var sandbox_list = []struct {
+		flavor   string
+		version  string
+		basedir  string
+		expected string
+	}{
+		{PerconaFlavor, "5.7.21", work_dir + "/10.3.7", PerconaFlavor},
+		{"", "ma10.2.14", "", MariaDBFlavor},
+		{"", "ps5.7.21", work_dir + "/ps5.7.21", PerconaFlavor},
+		{"", "10.3.7", work_dir + "/10.3.7", MariaDBFlavor},
+		{"", "8.0.11", work_dir + "/8.0.11", MySQLFlavor},
+		{"", "8.0.11", "", MySQLFlavor},
+	}
+	for _, item := range sandbox_list {
+		flavor := SandboxFlavor(item.flavor, item.version, item.basedir)
+		if flavor == item.expected {
+			t.Logf("ok     %-8s %-10s %s\n", item.flavor, item.version, flavor)
+		} else {
+			t.Logf("NOT OK %-8s %-10s %s (expected: %s)\n", item.flavor, item.version, flavor, item.expected)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Options of a MySQL configuration file, indexed by section and option name
+type MyCnf map[string]map[string]string
+
+// Reads a MySQL configuration file (such as my.sandbox.cnf)
+// and returns its options by section.
+// Option names are normalized, so that "server-id" and "server_id"
+// are both found as "server_id".
+// Options without a value (e.g. "log-slave-updates") get an empty string.
+func ParseMyCnf(filename string) MyCnf {
+	cnf := make(MyCnf)
+	if !FileExists(filename) {
+		return cnf
+	}
+	re_section := regexp.MustCompile(`^\[\s*([^\]]+?)\s*\]`)
+	section := ""
+	for _, line := range SlurpAsLines(filename) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		matches := re_section.FindStringSubmatch(line)
+		if matches != nil {
+			section = matches[1]
+			continue
+		}
+		key := line
+		value := ""
+		eq := strings.Index(line, "=")
+		if eq >= 0 {
+			key = line[0:eq]
+			value = strings.TrimSpace(line[eq+1:])
+			value = strings.Trim(value, `"'`)
+		}
+		key = strings.Replace(strings.TrimSpace(key), "-", "_", -1)
+		if cnf[section] == nil {
+			cnf[section] = make(map[string]string)
+		}
+		cnf[section][key] = value
+	}
+	return cnf
+}
+
+// Returns the value of an option in a given section,
+// or an empty string if the option was not found.
+func (cnf MyCnf) Option(section, key string) string {
+	options, ok := cnf[section]
+	if !ok {
+		return ""
+	}
+	return options[strings.Replace(key, "-", "_", -1)]
+}
+
+// Returns the server UUID from the auto.cnf file that the
+// server creates in its data directory (5.6+)
+func ReadServerUUID(datadir string) string {
+	return ParseMyCnf(datadir+"/auto.cnf").Option("auto", "server-uuid")
+}
@@ -0,0 +1,171 @@
+// Copyright © 2017-2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+// Version of the format of sbdescription.json.
+// Files without "schema_version" were written before version 2,
+// and are converted when read.
+const SandboxDescriptionSchemaVersion int = 2
+
+// Describes one database server within a deployment
+type NodeDescription struct {
+	Name       string   `json:"name"`
+	Role       string   `json:"role"` // single master slave node primary secondary
+	Directory  string   `json:"directory"`
+	Port       []int    `json:"port"`
+	ServerId   int      `json:"server_id"`
+	ServerUUID string   `json:"server_uuid"`
+	Socket     string   `json:"socket"`
+	Master     string   `json:"master,omitempty"` // the node this one replicates from
+	Peers      []string `json:"peers,omitempty"`  // the other members of a group
+}
+
+type SandboxDescription struct {
+	SchemaVersion     int               `json:"schema_version"`
+	Basedir           string            `json:"basedir"`
+	SBType            string            `json:"type"` // single multi master-slave group
+	Version           string            `json:"version"`
+	Flavor            string            `json:"flavor,omitempty"` // empty for sandboxes created before flavor detection
+	Port              []int             `json:"port"`
+	Nodes             int               `json:"nodes"`
+	Timestamp         string            `json:"timestamp"`
+	DbDeployerVersion string            `json:"dbdeployer_version"`
+	CommandLine       string            `json:"command_line"`
+	Flags             []string          `json:"flags"`
+	DbUser            string            `json:"db_user"`
+	RplUser           string            `json:"rpl_user,omitempty"`
+	RplPassword       string            `json:"rpl_password,omitempty"`
+	Socket            string            `json:"socket"`
+	ServerId          int               `json:"server_id"`
+	ServerUUID        string            `json:"server_uuid"`
+	NodeList          []NodeDescription `json:"node_list"`
+}
+
+func WriteSandboxDescription(destination string, sd SandboxDescription) {
+	sd.SchemaVersion = SandboxDescriptionSchemaVersion
+	if sd.Timestamp == "" {
+		sd.Timestamp = time.Now().Format(time.RFC3339)
+	}
+	if sd.DbDeployerVersion == "" {
+		sd.DbDeployerVersion = VersionDef
+	}
+	b, err := json.MarshalIndent(sd, " ", "\t")
+	if err != nil {
+		fmt.Println("error encoding sandbox description: ", err)
+		os.Exit(1)
+	}
+	json_string := fmt.Sprintf("%s", b)
+	filename := destination + "/sbdescription.json"
+	WriteString(json_string, filename)
+}
+
+func ReadSandboxDescription(sandbox_directory string) (sd SandboxDescription) {
+	filename := sandbox_directory + "/sbdescription.json"
+	sb_blob := SlurpAsBytes(filename)
+
+	err := json.Unmarshal(sb_blob, &sd)
+	if err != nil {
+		fmt.Println("error decoding sandbox description: ", err)
+		os.Exit(1)
+	}
+	if sd.SchemaVersion < SandboxDescriptionSchemaVersion {
+		sd = migrate_sandbox_description(sandbox_directory, sd)
+	}
+	return
+}
+
+// Fills the fields that were introduced with schema version 2,
+// using what can be found in the sandbox directory.
+// The file is not modified: the conversion happens every time
+// an old description is read.
+func migrate_sandbox_description(sandbox_directory string, sd SandboxDescription) SandboxDescription {
+	filename := sandbox_directory + "/sbdescription.json"
+	sd.SchemaVersion = SandboxDescriptionSchemaVersion
+	if sd.Timestamp == "" {
+		stat, err := os.Stat(filename)
+		if err == nil {
+			sd.Timestamp = stat.ModTime().Format(time.RFC3339)
+		}
+	}
+	if sd.Nodes == 0 {
+		cnf := ParseMyCnf(sandbox_directory + "/my.sandbox.cnf")
+		sd.DbUser = cnf.Option("client", "user")
+		sd.Socket = cnf.Option("mysqld", "socket")
+		sd.ServerId, _ = strconv.Atoi(cnf.Option("mysqld", "server-id"))
+		sd.ServerUUID = ReadServerUUID(sandbox_directory + "/data")
+		node := NodeDescription{
+			Name:       path.Base(sandbox_directory),
+			Role:       "single",
+			Directory:  sandbox_directory,
+			Port:       sd.Port,
+			ServerId:   sd.ServerId,
+			ServerUUID: sd.ServerUUID,
+			Socket:     sd.Socket,
+		}
+		// Nodes of composite sandboxes were recorded as "single"
+		// up to schema version 1. Their role is deduced from the
+		// directory structure.
+		parent := path.Dir(sandbox_directory)
+		if DirExists(parent + "/master") {
+			if node.Name == "master" {
+				node.Role = "master"
+			} else {
+				node.Role = "slave"
+				node.Master = "master"
+			}
+		} else if sd.SBType == "group-node" || FileExists(parent+"/sbdescription.json") {
+			node.Role = "node"
+		}
+		sd.NodeList = []NodeDescription{node}
+		return sd
+	}
+	var node_names []string
+	if DirExists(sandbox_directory + "/master") {
+		node_names = append(node_names, "master")
+	}
+	for N := 1; N <= sd.Nodes; N++ {
+		node_names = append(node_names, fmt.Sprintf("node%d", N))
+	}
+	for _, node_name := range node_names {
+		node_dir := sandbox_directory + "/" + node_name
+		if !FileExists(node_dir + "/sbdescription.json") {
+			continue
+		}
+		nd := ReadSandboxDescription(node_dir)
+		if sd.DbUser == "" {
+			sd.DbUser = nd.DbUser
+		}
+		for _, node := range nd.NodeList {
+			if node.Role == "node" && (sd.SBType == "group-multi-primary" || sd.SBType == "group-single-primary") {
+				for _, peer := range node_names {
+					if peer != node_name {
+						node.Peers = append(node.Peers, peer)
+					}
+				}
+			}
+			sd.NodeList = append(sd.NodeList, node)
+		}
+	}
+	return sd
+}
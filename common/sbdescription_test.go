@@ -0,0 +1,65 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Descriptions written before schema version 2 must still be readable,
+// and the roles of the nodes must be deduced from the directory structure.
+func TestReadOldSandboxDescription(t *testing.T) {
+	t.Parallel()
+	sandbox_home, err := ioutil.TempDir("", "sbdescription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sandbox_home)
+	sandbox_dir := sandbox_home + "/rsandbox_5_7_21"
+	old_descriptions := map[string]string{
+		"":        `{"basedir":"/opt/mysql/5.7.21","type":"master-slave","version":"5.7.21","port":[0],"nodes":2}`,
+		"/master": `{"basedir":"/opt/mysql/5.7.21","type":"single","version":"5.7.21","port":[17922],"nodes":0}`,
+		"/node1":  `{"basedir":"/opt/mysql/5.7.21","type":"single","version":"5.7.21","port":[17923],"nodes":0}`,
+		"/node2":  `{"basedir":"/opt/mysql/5.7.21","type":"single","version":"5.7.21","port":[17924],"nodes":0}`,
+	}
+	for dir, contents := range old_descriptions {
+		os.MkdirAll(sandbox_dir+dir, 0755)
+		WriteString(contents, sandbox_dir+dir+"/sbdescription.json")
+	}
+	WriteString("[client]\nuser = msandbox\n[mysqld]\nserver-id=200\nsocket = /tmp/mysql_sandbox17923.sock\n",
+		sandbox_dir+"/node1/my.sandbox.cnf")
+
+	sd := ReadSandboxDescription(sandbox_dir)
+	if sd.SchemaVersion != SandboxDescriptionSchemaVersion {
+		t.Logf("NOT OK schema version %d", sd.SchemaVersion)
+		t.Fail()
+	}
+	expected := []struct {
+		name   string
+		role   string
+		master string
+	}{
+		{"master", "master", ""},
+		{"node1", "slave", "master"},
+		{"node2", "slave", "master"},
+	}
+	if len(sd.NodeList) != len(expected) {
+		t.Fatalf("NOT OK nodes found: %d - expected: %d", len(sd.NodeList), len(expected))
+	}
+	for N, node := range sd.NodeList {
+		if node.Name == expected[N].name && node.Role == expected[N].role && node.Master == expected[N].master {
+			t.Logf("ok     %-8s %-8s %s\n", node.Name, node.Role, node.Master)
+		} else {
+			t.Logf("NOT OK %-8s %-8s %s\n", node.Name, node.Role, node.Master)
+			t.Fail()
+		}
+	}
+	if sd.NodeList[1].ServerId != 200 || sd.NodeList[1].Socket != "/tmp/mysql_sandbox17923.sock" {
+		t.Logf("NOT OK node1 options: %#v", sd.NodeList[1])
+		t.Fail()
+	}
+	if sd.DbUser != "msandbox" {
+		t.Logf("NOT OK db user '%s'", sd.DbUser)
+		t.Fail()
+	}
+}
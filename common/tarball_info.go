@@ -0,0 +1,62 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Name of the file, inside an unpacked base directory, that
+// describes where the binaries come from.
+const TarballInfoFile string = "dbdeployer_tarball.json"
+
+type TarballInfo struct {
+	Tarball           string   `json:"tarball"`
+	Version           string   `json:"version"`
+	Flavor            string   `json:"flavor"`
+	Checksum          string   `json:"checksum,omitempty"` // verified during unpack
+	Excluded          []string `json:"excluded,omitempty"` // patterns skipped by a slim unpack
+	Timestamp         string   `json:"timestamp"`
+	DbDeployerVersion string   `json:"dbdeployer_version"`
+}
+
+func WriteTarballInfo(basedir string, info TarballInfo) error {
+	if info.Timestamp == "" {
+		info.Timestamp = time.Now().Format(time.RFC3339)
+	}
+	if info.DbDeployerVersion == "" {
+		info.DbDeployerVersion = VersionDef
+	}
+	b, err := json.MarshalIndent(info, " ", "\t")
+	if err != nil {
+		return fmt.Errorf("error encoding tarball info: %s", err)
+	}
+	return WriteString(string(b), basedir+"/"+TarballInfoFile)
+}
+
+func ReadTarballInfo(basedir string) (TarballInfo, error) {
+	var info TarballInfo
+	filename := basedir + "/" + TarballInfoFile
+	if !FileExists(filename) {
+		return info, fmt.Errorf("file %s not found", filename)
+	}
+	err := json.Unmarshal(SlurpAsBytes(filename), &info)
+	if err != nil {
+		return info, fmt.Errorf("error decoding tarball info %s: %s", filename, err)
+	}
+	return info, nil
+}
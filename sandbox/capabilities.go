@@ -0,0 +1,122 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import "github.com/datacharmer/dbdeployer/common"
+
+const (
+	InitializeInsecure  = "initialize-insecure"
+	CreateUserGrants    = "create-user-grants"
+	CachingSha2Default  = "caching-sha2-default"
+	UpgradeAtStartup    = "upgrade-at-startup"
+	MySQLGtid           = "mysql-gtid"
+	GroupReplication    = "group-replication"
+	ReplicaStatements   = "replica-statements"
+	ReplicationSourceTo = "replication-source-to"
+	SourcePosWait       = "source-pos-wait"
+	BinaryLogStatus     = "binary-log-status"
+	MariaDBGtid         = "mariadb-gtid"
+	RootSocketAuth      = "root-socket-auth"
+	MariaDBGrants       = "mariadb-grants"
+)
+
+// A feature of the server, and the first version of each flavor
+// that has it. Flavors that are not listed don't have it.
+type Capability struct {
+	Description string
+	Since       map[string][]int
+}
+
+// Same versions for MySQL and Percona Server, which follows its releases
+func mysql_and_percona(version []int) map[string][]int {
+	return map[string][]int{
+		common.MySQLFlavor:   version,
+		common.PerconaFlavor: version,
+	}
+}
+
+// MariaDB only
+func mariadb(version []int) map[string][]int {
+	return map[string][]int{common.MariaDBFlavor: version}
+}
+
+var Capabilities = map[string]Capability{
+	InitializeInsecure: {
+		Description: "the data directory is created with mysqld --initialize-insecure instead of mysql_install_db",
+		Since:       mysql_and_percona([]int{5, 7, 0}),
+	},
+	CreateUserGrants: {
+		Description: "users are created with CREATE USER before GRANT",
+		Since:       mysql_and_percona([]int{5, 7, 6}),
+	},
+	CachingSha2Default: {
+		Description: "the default authentication plugin is caching_sha2_password",
+		Since:       mysql_and_percona([]int{8, 0, 4}),
+	},
+	UpgradeAtStartup: {
+		Description: "the server upgrades the data directory at startup, without mysql_upgrade",
+		Since:       mysql_and_percona([]int{8, 0, 16}),
+	},
+	MySQLGtid: {
+		Description: "GTID enabled with gtid_mode and enforce-gtid-consistency",
+		Since:       mysql_and_percona([]int{5, 6, 9}),
+	},
+	GroupReplication: {
+		Description: "group replication plugin",
+		Since:       mysql_and_percona([]int{5, 7, 17}),
+	},
+	ReplicaStatements: {
+		Description: "START/STOP/RESET REPLICA and SHOW REPLICA STATUS",
+		Since:       mysql_and_percona([]int{8, 0, 22}),
+	},
+	ReplicationSourceTo: {
+		Description: "CHANGE REPLICATION SOURCE TO",
+		Since:       mysql_and_percona([]int{8, 0, 23}),
+	},
+	SourcePosWait: {
+		Description: "source_pos_wait() and --skip-replica-start",
+		Since:       mysql_and_percona([]int{8, 0, 26}),
+	},
+	BinaryLogStatus: {
+		Description: "SHOW BINARY LOG STATUS and RESET BINARY LOGS AND GTIDS",
+		Since:       mysql_and_percona([]int{8, 2, 0}),
+	},
+	MariaDBGtid: {
+		Description: "domain-based GTID, always enabled, used by slaves with MASTER_USE_GTID",
+		Since:       mariadb([]int{10, 0, 2}),
+	},
+	RootSocketAuth: {
+		Description: "mysql_install_db creates root with unix_socket authentication",
+		Since:       mariadb([]int{10, 4, 3}),
+	},
+	MariaDBGrants: {
+		Description: "MariaDB grants, where anonymous users are removed with DROP USER, as mysql.user may be a view",
+		Since:       mariadb([]int{5, 1, 0}),
+	},
+}
+
+// Tells whether a server of the given flavor and version has a capability.
+// An empty flavor is taken from the prefix of the version (e.g. ma10.2.14),
+// and is MySQL when there is no prefix.
+func HasCapability(flavor, capability, version string) bool {
+	if flavor == "" {
+		flavor = common.SandboxFlavor("", version, "")
+	}
+	since, ok := Capabilities[capability].Since[flavor]
+	if !ok {
+		return false
+	}
+	return GreaterOrEqualVersion(version, since)
+}
@@ -0,0 +1,276 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+)
+
+// Files that belong to the source of a clone, and must not be
+// inherited by the new sandbox.
+// The server creates a new auto.cnf, and with it a new server UUID.
+var clone_removed_files = []string{
+	"data/auto.cnf",
+	"data/mysql_sandbox*.pid",
+	"my.sandbox_np.cnf",
+	common.SandboxLockFile,
+}
+
+// Returns a function that changes the template data of a clone:
+// new paths, new ports, and a server ID based on the new port.
+func clone_template_changes(old_dir, new_dir string, ports map[int]int) func(common.Smap) {
+	return func(data common.Smap) {
+		replace_template_paths(data, old_dir, new_dir)
+		replace_template_ports(data, ports)
+		if port, ok := data["Port"].(int); ok {
+			data["ServerId"] = fmt.Sprintf("server-id=%d", port)
+		}
+	}
+}
+
+// Changes the ports in the template data.
+// Besides the port of each node, the ports appear in the options of
+// group replication (local address and seeds.)
+func replace_template_ports(data common.Smap, ports map[int]int) {
+	for key, value := range data {
+		switch v := value.(type) {
+		case int:
+			if key == "Port" || key == "MasterPort" {
+				if new_port, ok := ports[v]; ok {
+					data[key] = new_port
+				}
+			}
+		case string:
+			if key == "ReplOptions" {
+				for old_port, new_port := range ports {
+					v = strings.Replace(v, fmt.Sprintf("127.0.0.1:%d\n", old_port), fmt.Sprintf("127.0.0.1:%d\n", new_port), -1)
+					v = strings.Replace(v, fmt.Sprintf("127.0.0.1:%d,", old_port), fmt.Sprintf("127.0.0.1:%d,", new_port), -1)
+				}
+				data[key] = v
+			}
+		case []common.Smap:
+			for _, item := range v {
+				replace_template_ports(item, ports)
+			}
+		}
+	}
+}
+
+func map_ports(old_ports []int, ports map[int]int) []int {
+	var new_ports []int
+	for _, port := range old_ports {
+		new_port, ok := ports[port]
+		if !ok {
+			new_port = port
+		}
+		new_ports = append(new_ports, new_port)
+	}
+	return new_ports
+}
+
+// Updates the scripts and the description of one server in a cloned sandbox
+func rewrite_cloned_node(node_dir string, change func(common.Smap), ports map[int]int) common.NodeDescription {
+	for _, pattern := range clone_removed_files {
+		files, _ := filepath.Glob(node_dir + "/" + pattern)
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}
+	RewriteSandboxScripts(node_dir, "single", change)
+	data := ReadTemplateData(node_dir)
+	port := data["Port"].(int)
+
+	sbd := common.ReadSandboxDescription(node_dir)
+	sbd.Timestamp = ""
+	sbd.Port = map_ports(sbd.Port, ports)
+	sbd.ServerId = port
+	sbd.ServerUUID = ""
+	sbd.Socket = fmt.Sprintf("%s/mysql_sandbox%d.sock", data["GlobalTmpDir"], port)
+	for N := range sbd.NodeList {
+		sbd.NodeList[N].Directory = node_dir
+		sbd.NodeList[N].Port = sbd.Port
+		sbd.NodeList[N].ServerId = sbd.ServerId
+		sbd.NodeList[N].ServerUUID = ""
+		sbd.NodeList[N].Socket = sbd.Socket
+	}
+	common.WriteSandboxDescription(node_dir, sbd)
+	return sbd.NodeList[0]
+}
+
+// Adapts a copy of a sandbox to its new location.
+// Every node gets new ports (according to the given map of old and
+// new ports), a new server ID, and scripts rewritten for the new
+// directory. The server UUID is generated when the clone starts.
+func RewriteClonedSandbox(source_dir, new_dir string, ports map[int]int) {
+	rewrite_copied_sandbox(new_dir, clone_template_changes(source_dir, new_dir, ports), ports)
+}
+
+// Adapts an imported sandbox to the local host.
+// Besides the changes made to a clone, the scripts use the server
+// binaries found in basedir, and the current operating system user.
+func RewriteImportedSandbox(old_dir, new_dir, basedir string, ports map[int]int) {
+	clone_change := clone_template_changes(old_dir, new_dir, ports)
+	change := func(data common.Smap) {
+		old_basedir, _ := data["Basedir"].(string)
+		old_user, _ := data["OsUser"].(string)
+		if old_basedir != "" {
+			replace_template_paths(data, old_basedir, basedir)
+		}
+		if init_script, ok := data["InitScript"].(string); ok {
+			init_script = strings.Replace(init_script, "--basedir="+old_basedir+" ", "--basedir="+basedir+" ", -1)
+			data["InitScript"] = strings.Replace(init_script, "--user="+old_user+" ", "--user="+os.Getenv("USER")+" ", -1)
+		}
+		if old_user != "" {
+			data["OsUser"] = os.Getenv("USER")
+		}
+		clone_change(data)
+	}
+	rewrite_copied_sandbox(new_dir, change, ports)
+	for _, dir := range append([]string{new_dir}, common.NodeDirs(common.SandboxItemFromDir(new_dir))...) {
+		sbd := common.ReadSandboxDescription(dir)
+		sbd.Basedir = basedir
+		common.WriteSandboxDescription(dir, sbd)
+	}
+}
+
+func rewrite_copied_sandbox(new_dir string, change func(common.Smap), ports map[int]int) {
+	sbd := common.ReadSandboxDescription(new_dir)
+	if sbd.Nodes == 0 {
+		rewrite_cloned_node(new_dir, change, ports)
+		return
+	}
+	var node_list []common.NodeDescription
+	for _, node := range sbd.NodeList {
+		node_dir := new_dir + "/" + filepath.Base(node.Directory)
+		nd := rewrite_cloned_node(node_dir, change, ports)
+		nd.Master = node.Master
+		nd.Peers = node.Peers
+		node_list = append(node_list, nd)
+	}
+	os.Remove(new_dir + "/" + common.SandboxLockFile)
+	RewriteSandboxScripts(new_dir, sbd.SBType, change)
+	sbd.Timestamp = ""
+	sbd.NodeList = node_list
+	common.WriteSandboxDescription(new_dir, sbd)
+}
+
+// Reads the output of SHOW SLAVE STATUS\G into a map
+func slave_status(node_dir string, commands common.Smap) map[string]string {
+	status := make(map[string]string)
+	output, err := common.Run_cmd_output(node_dir+"/use", []string{"-u", "root", "-e", commands["ShowSlaveStatus"].(string) + "\\G"})
+	if err != nil {
+		return status
+	}
+	for _, line := range strings.Split(output, "\n") {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		status[strings.TrimSpace(line[:colon])] = strings.TrimSpace(line[colon+1:])
+	}
+	return status
+}
+
+// Points a cloned slave to the new port of the master.
+// Changing the port would reset the replication coordinates, and
+// therefore the ones already executed by the slave are given again,
+// unless the slave uses GTID auto positioning.
+func repoint_cloned_slave(node_dir string, master_port int, commands common.Smap) {
+	status := slave_status(node_dir, commands)
+	master_label := commands["MasterLabel"].(string)
+	change := fmt.Sprintf("%s %s=%d", commands["ChangeMasterTo"], commands["MasterPortParam"], master_port)
+	log_file := status["Relay_"+master_label+"_Log_File"]
+	log_pos := status["Exec_"+master_label+"_Log_Pos"]
+	if status["Auto_Position"] != "1" {
+		if log_file != "" && log_pos != "" {
+			change += fmt.Sprintf(", %s='%s', %s=%s", commands["MasterLogFileParam"], log_file, commands["MasterLogPosParam"], log_pos)
+		} else {
+			fmt.Printf("Replication coordinates of %s not found. Replication restarts from the current position of the master\n", node_dir)
+		}
+	}
+	query := fmt.Sprintf("%s; %s; %s", commands["StopSlave"], change, commands["StartSlave"])
+	fmt.Printf("# %s: %s\n", filepath.Base(node_dir), query)
+	output, err := common.Run_cmd_output(node_dir+"/use", []string{"-u", "root", "-e", query})
+	if err != nil {
+		fmt.Printf("Error repointing %s: %s\n%s\n", node_dir, err, output)
+		os.Exit(1)
+	}
+}
+
+// Starts a cloned sandbox.
+// Slaves are started without replication, so that they can be pointed
+// to the new port of the master before they attempt to connect.
+func StartClonedSandbox(new_dir string) {
+	sbd := common.ReadSandboxDescription(new_dir)
+	commands := ReplicationCommands(common.SandboxFlavor(sbd.Flavor, sbd.Version, sbd.Basedir), sbd.Version)
+	run := func(script string, args ...string) {
+		output, err := common.Run_cmd_output(script, args)
+		fmt.Print(output)
+		if err != nil {
+			fmt.Printf("Error running %s: %s\n", script, err)
+			os.Exit(1)
+		}
+	}
+	switch sbd.SBType {
+	case "master-slave":
+		master_port := 0
+		for _, node := range sbd.NodeList {
+			if node.Role == "master" {
+				master_port = node.Port[0]
+				run(node.Directory + "/start")
+			}
+		}
+		for _, node := range sbd.NodeList {
+			if node.Role == "slave" {
+				run(node.Directory+"/start", commands["SkipSlaveStart"].(string))
+				repoint_cloned_slave(node.Directory, master_port, commands)
+			}
+		}
+	case "multiple":
+		run(new_dir + "/start_all")
+	case "group-multi-primary", "group-single-primary":
+		run(new_dir + "/start_all")
+		run(new_dir + "/initialize_nodes")
+	default:
+		run(new_dir + "/start")
+	}
+	refresh_server_uuids(new_dir)
+}
+
+// Records in the descriptions the server UUIDs that were
+// created when the servers started for the first time
+func refresh_server_uuids(sandbox_dir string) {
+	sbd := common.ReadSandboxDescription(sandbox_dir)
+	for N, node := range sbd.NodeList {
+		uuid := common.ReadServerUUID(node.Directory + "/data")
+		sbd.NodeList[N].ServerUUID = uuid
+		if node.Directory == sandbox_dir {
+			sbd.ServerUUID = uuid
+			continue
+		}
+		nd := common.ReadSandboxDescription(node.Directory)
+		nd.ServerUUID = uuid
+		for M := range nd.NodeList {
+			nd.NodeList[M].ServerUUID = uuid
+		}
+		common.WriteSandboxDescription(node.Directory, nd)
+	}
+	common.WriteSandboxDescription(sandbox_dir, sbd)
+}
@@ -0,0 +1,154 @@
+package sandbox
+
+// Templates for connection snippets.
+// They are written in the connection_info directory of every sandbox,
+// and can be used as a starting point to connect from applications.
+
+var (
+	connection_go_template string = `// Template : {{.TemplateName}}
+// Connects to the sandbox in {{.SandboxDir}}
+// Requires the driver github.com/go-sql-driver/mysql
+package main
+
+import (
+    "database/sql"
+    "fmt"
+
+    _ "github.com/go-sql-driver/mysql"
+)
+
+// TCP connection
+const dsn = "{{.DbUser}}:{{.DbPassword}}@tcp({{.Host}}:{{.Port}})/test"
+
+// Socket connection
+// const dsn = "{{.DbUser}}:{{.DbPassword}}@unix({{.GlobalTmpDir}}/mysql_sandbox{{.Port}}.sock)/test"
+
+func main() {
+    db, err := sql.Open("mysql", dsn)
+    if err != nil {
+        panic(err)
+    }
+    defer db.Close()
+    var version string
+    err = db.QueryRow("SELECT VERSION()").Scan(&version)
+    if err != nil {
+        panic(err)
+    }
+    fmt.Println(version)
+}
+`
+	connection_java_template string = `// Template : {{.TemplateName}}
+// Connects to the sandbox in {{.SandboxDir}}
+// Requires MySQL Connector/J in the class path
+import java.sql.Connection;
+import java.sql.DriverManager;
+import java.sql.ResultSet;
+import java.sql.Statement;
+
+public class SandboxConnection {
+    static final String URL = "jdbc:mysql://{{.Host}}:{{.Port}}/test?useSSL=false";
+    static final String USER = "{{.DbUser}}";
+    static final String PASSWORD = "{{.DbPassword}}";
+
+    public static void main(String[] args) throws Exception {
+        try (Connection conn = DriverManager.getConnection(URL, USER, PASSWORD);
+             Statement stmt = conn.createStatement();
+             ResultSet rs = stmt.executeQuery("SELECT VERSION()")) {
+            while (rs.next()) {
+                System.out.println(rs.getString(1));
+            }
+        }
+    }
+}
+`
+	connection_python_template string = `#!/usr/bin/env python
+# Template : {{.TemplateName}}
+# Connects to the sandbox in {{.SandboxDir}}
+# Requires mysql-connector-python
+import mysql.connector
+
+config = {
+    'user': '{{.DbUser}}',
+    'password': '{{.DbPassword}}',
+    'host': '{{.Host}}',
+    'port': {{.Port}},
+    # 'unix_socket': '{{.GlobalTmpDir}}/mysql_sandbox{{.Port}}.sock',
+    'database': 'test',
+}
+
+cnx = mysql.connector.connect(**config)
+cursor = cnx.cursor()
+cursor.execute('SELECT VERSION()')
+for (version,) in cursor:
+    print(version)
+cnx.close()
+`
+	connection_perl_template string = `#!/usr/bin/env perl
+# Template : {{.TemplateName}}
+# Connects to the sandbox in {{.SandboxDir}}
+# Requires DBI and DBD::mysql
+use strict;
+use warnings;
+use DBI;
+
+my $dsn = 'DBI:mysql:database=test;host={{.Host}};port={{.Port}}';
+# my $dsn = 'DBI:mysql:database=test;mysql_socket={{.GlobalTmpDir}}/mysql_sandbox{{.Port}}.sock';
+my $dbh = DBI->connect($dsn, '{{.DbUser}}', '{{.DbPassword}}', { RaiseError => 1 });
+my ($version) = $dbh->selectrow_array('SELECT VERSION()');
+print "$version\n";
+$dbh->disconnect;
+`
+	connection_php_template string = `<?php
+// Template : {{.TemplateName}}
+// Connects to the sandbox in {{.SandboxDir}}
+// Requires the PDO MySQL driver
+$dsn = 'mysql:host={{.Host}};port={{.Port}};dbname=test';
+// $dsn = 'mysql:unix_socket={{.GlobalTmpDir}}/mysql_sandbox{{.Port}}.sock;dbname=test';
+$pdo = new PDO($dsn, '{{.DbUser}}', '{{.DbPassword}}');
+$pdo->setAttribute(PDO::ATTR_ERRMODE, PDO::ERRMODE_EXCEPTION);
+$version = $pdo->query('SELECT VERSION()')->fetchColumn();
+echo $version . "\n";
+`
+	connection_my_cnf_template string = `# Template : {{.TemplateName}}
+# Client options for the sandbox in {{.SandboxDir}}
+# Usage: mysql --defaults-file={{.SandboxDir}}/connection_info/.my.cnf
+[client]
+user     = {{.DbUser}}
+password = {{.DbPassword}}
+host     = {{.Host}}
+port     = {{.Port}}
+socket   = {{.GlobalTmpDir}}/mysql_sandbox{{.Port}}.sock
+`
+	ConnectionTemplates = TemplateCollection{
+		"connection_go_template": TemplateDesc{
+			Description: "Go program using the go-sql-driver DSN",
+			Notes:       "Written to connection_info/connection.go",
+			Contents:    connection_go_template,
+		},
+		"connection_java_template": TemplateDesc{
+			Description: "Java program using a JDBC URL",
+			Notes:       "Written to connection_info/SandboxConnection.java",
+			Contents:    connection_java_template,
+		},
+		"connection_python_template": TemplateDesc{
+			Description: "Python script using mysql-connector",
+			Notes:       "Written to connection_info/connection.py",
+			Contents:    connection_python_template,
+		},
+		"connection_perl_template": TemplateDesc{
+			Description: "Perl script using DBI",
+			Notes:       "Written to connection_info/connection.pl",
+			Contents:    connection_perl_template,
+		},
+		"connection_php_template": TemplateDesc{
+			Description: "PHP script using PDO",
+			Notes:       "Written to connection_info/connection.php",
+			Contents:    connection_php_template,
+		},
+		"connection_my_cnf_template": TemplateDesc{
+			Description: "Client options file",
+			Notes:       "Written to connection_info/.my.cnf",
+			Contents:    connection_my_cnf_template,
+		},
+	}
+)
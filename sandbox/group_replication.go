@@ -26,6 +26,15 @@ loose-group-replication-single-primary-mode=off
 `
 )
 
+// Writes the scripts of a group replication sandbox, including
+// the shortcuts to each node (n1, n2, n3)
+func write_group_scripts(sandbox_dir string, data common.Smap) {
+	write_multiple_scripts(sandbox_dir, data)
+	write_script(GroupTemplates, "initialize_nodes", "init_nodes_template", sandbox_dir, data, true)
+	write_script(GroupTemplates, "check_nodes", "check_nodes_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, "test_replication", "test_replication_template", sandbox_dir, data, true)
+}
+
 func CreateGroupReplication(sdef SandboxDef, origin string, nodes int) {
 	// fmt.Println("Group replication not implemented yet")
 	vList := VersionToList(sdef.Version)
@@ -57,6 +66,10 @@ func CreateGroupReplication(sdef SandboxDef, origin string, nodes int) {
 		"SandboxDir": sdef.SandboxDir,
 		"Nodes":      []common.Smap{},
 	}
+	data = merge_smap(data, ReplicationCommands(sdef.Flavor, sdef.Version))
+	// Group scripts use node names only. The names of master and slaves
+	// are needed by test_replication, which looks for both
+	data = merge_smap(data, ReplicationScriptNames(LegacyTerminology))
 	base_group_port := base_port + GroupPortDelta
 	connection_string := ""
 	for i := 0; i < nodes; i++ {
@@ -73,6 +86,10 @@ func CreateGroupReplication(sdef SandboxDef, origin string, nodes int) {
 		sb_type = "group-single-primary"
 		single_multi_primary = GroupReplSinglePrimary
 	}
+	var node_names []string
+	for i := 1; i <= nodes; i++ {
+		node_names = append(node_names, fmt.Sprintf("node%d", i))
+	}
 	for i := 1; i <= nodes; i++ {
 		group_port := base_group_port + i
 		data["Nodes"] = append(data["Nodes"].([]common.Smap), common.Smap{
@@ -94,34 +111,40 @@ func CreateGroupReplication(sdef SandboxDef, origin string, nodes int) {
 		sdef.Multi = true
 		sdef.Prompt = fmt.Sprintf("node%d", i)
 		sdef.SBType = "group-node"
-		CreateSingleSandbox(sdef, origin)
-		var data_node common.Smap = common.Smap{
-			"Node":       i,
-			"SandboxDir": sdef.SandboxDir,
-			"Copyright":  Copyright,
+		// In single-primary mode, the node that bootstraps the group
+		// becomes the primary.
+		sdef.NodeRole = "primary"
+		if sdef.SinglePrimary && i > 1 {
+			sdef.NodeRole = "secondary"
+		}
+		sdef.NodePeers = []string{}
+		for _, peer := range node_names {
+			if peer != sdef.DirName {
+				sdef.NodePeers = append(sdef.NodePeers, peer)
+			}
 		}
-		write_script(MultipleTemplates, fmt.Sprintf("n%d", i), "node_template", sdef.SandboxDir, data_node, true)
+		CreateSingleSandbox(sdef, origin)
 	}
 
 	sb_desc := common.SandboxDescription{
-		Basedir: sdef.Basedir + "/" + sdef.Version,
-		SBType:  sb_type,
-		Version: sdef.Version,
-		Port:    []int{0},
-		Nodes:   nodes,
+		Basedir:     SandboxBasedir(sdef),
+		SBType:      sb_type,
+		Version:     sdef.Version,
+		Flavor:      sdef.Flavor,
+		Port:        []int{0},
+		Nodes:       nodes,
+		CommandLine: sdef.CommandLine,
+		Flags:       sdef.Flags,
+		DbUser:      sdef.DbUser,
+		RplUser:     sdef.RplUser,
+		RplPassword: sdef.RplPassword,
+		NodeList:    collect_nodes(sdef.SandboxDir, node_names),
 	}
 	common.WriteSandboxDescription(sdef.SandboxDir, sb_desc)
+	common.UpdateCatalog(common.SandboxItemFromDir(sdef.SandboxDir))
 
-	write_script(MultipleTemplates, "start_all", "start_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "restart_all", "restart_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "status_all", "status_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "test_sb_all", "test_sb_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "stop_all", "stop_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "send_kill_all", "send_kill_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "use_all", "use_multi_template", sdef.SandboxDir, data, true)
-	write_script(GroupTemplates, "initialize_nodes", "init_nodes_template", sdef.SandboxDir, data, true)
-	write_script(GroupTemplates, "check_nodes", "check_nodes_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "test_replication", "test_replication_template", sdef.SandboxDir, data, true)
+	write_group_scripts(sdef.SandboxDir, data)
+	save_template_data(sdef.SandboxDir, data)
 
 	fmt.Println(sdef.SandboxDir + "/initialize_nodes")
 	common.Run_cmd(sdef.SandboxDir + "/initialize_nodes")
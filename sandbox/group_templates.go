@@ -8,8 +8,8 @@ var (
 # Template : {{.TemplateName}}
 multi_sb={{.SandboxDir}}
 {{range .Nodes}}
-    user_cmd='reset master;'
-    user_cmd="$user_cmd CHANGE MASTER TO MASTER_USER='rsandbox', MASTER_PASSWORD='rsandbox' FOR CHANNEL 'group_replication_recovery';"
+    user_cmd='{{$.ResetMaster}};'
+    user_cmd="$user_cmd {{$.ChangeMasterTo}} {{$.MasterUserParam}}='{{.RplUser}}', {{$.MasterPasswordParam}}='{{.RplPassword}}' FOR CHANNEL 'group_replication_recovery';"
 	echo "# Node {{.Node}} # $user_cmd"
     $multi_sb/node{{.Node}}/use -u root -e "$user_cmd"
 {{end}}
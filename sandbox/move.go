@@ -0,0 +1,168 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+)
+
+// The data used to render the scripts of a sandbox is saved in this file,
+// so that the scripts can be written again when the sandbox changes.
+const TemplateDataFile string = "sbtemplate.json"
+
+func save_template_data(sandbox_dir string, data common.Smap) {
+	b, err := json.MarshalIndent(data, " ", "\t")
+	if err != nil {
+		fmt.Println("error encoding template data: ", err)
+		os.Exit(1)
+	}
+	err = common.WriteString(string(b), sandbox_dir+"/"+TemplateDataFile)
+	if err != nil {
+		fmt.Printf("error writing template data in %s: %s\n", sandbox_dir, err)
+		os.Exit(1)
+	}
+}
+
+func HasTemplateData(sandbox_dir string) bool {
+	return common.FileExists(sandbox_dir + "/" + TemplateDataFile)
+}
+
+// Reads the template data saved in a sandbox.
+// Numbers and lists of nodes get back the types that the
+// script writing functions expect.
+func ReadTemplateData(sandbox_dir string) common.Smap {
+	blob := common.SlurpAsBytes(sandbox_dir + "/" + TemplateDataFile)
+	decoder := json.NewDecoder(bytes.NewReader(blob))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	err := decoder.Decode(&raw)
+	if err != nil {
+		fmt.Printf("error decoding template data in %s: %s\n", sandbox_dir, err)
+		os.Exit(1)
+	}
+	return normalize_template_value(raw).(common.Smap)
+}
+
+func normalize_template_value(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err == nil {
+			return int(n)
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		data := common.Smap{}
+		for key, item := range v {
+			data[key] = normalize_template_value(item)
+		}
+		return data
+	case []interface{}:
+		// Lists in template data are always lists of nodes
+		list := []common.Smap{}
+		for _, item := range v {
+			if m, ok := normalize_template_value(item).(common.Smap); ok {
+				list = append(list, m)
+			}
+		}
+		return list
+	}
+	return value
+}
+
+// Replaces old_dir with new_dir in every path found in the template data
+func replace_template_paths(value interface{}, old_dir, new_dir string) interface{} {
+	switch v := value.(type) {
+	case string:
+		if v == old_dir {
+			return new_dir
+		}
+		return strings.Replace(v, old_dir+"/", new_dir+"/", -1)
+	case common.Smap:
+		for key, item := range v {
+			v[key] = replace_template_paths(item, old_dir, new_dir)
+		}
+		return v
+	case []common.Smap:
+		for N, item := range v {
+			v[N] = replace_template_paths(item, old_dir, new_dir).(common.Smap)
+		}
+		return v
+	}
+	return value
+}
+
+// Writes again all the scripts of a sandbox, using the saved template data.
+// The function changes the template data with the given function before
+// writing, and saves the result.
+func RewriteSandboxScripts(sandbox_dir string, sb_type string, change func(common.Smap)) {
+	data := ReadTemplateData(sandbox_dir)
+	data["Copyright"] = Copyright
+	// Sandboxes deployed before flavors were recorded
+	if flavor, _ := data["Flavor"].(string); flavor == "" {
+		version, _ := data["Version"].(string)
+		basedir, _ := data["Basedir"].(string)
+		if version != "" || basedir != "" {
+			data["Flavor"] = common.SandboxFlavor("", version, basedir)
+		}
+	}
+	change(data)
+	switch sb_type {
+	case "master-slave":
+		write_replication_scripts(sandbox_dir, data)
+	case "multiple":
+		write_multiple_scripts(sandbox_dir, data)
+	case "group-multi-primary", "group-single-primary":
+		write_group_scripts(sandbox_dir, data)
+	default:
+		write_script(SingleTemplates, "init_db", "init_db_template", sandbox_dir, data, true)
+		write_single_scripts(sandbox_dir, data)
+	}
+	save_template_data(sandbox_dir, data)
+}
+
+// Updates a sandbox that was moved from old_dir to new_dir:
+// the scripts and configuration files of the sandbox and of its
+// nodes are written again with the new paths, and the description
+// is updated.
+func RelocateSandbox(old_dir, new_dir string) {
+	change_paths := func(data common.Smap) {
+		replace_template_paths(data, old_dir, new_dir)
+	}
+	sbd := common.ReadSandboxDescription(new_dir)
+	for N, node := range sbd.NodeList {
+		node_dir := strings.Replace(node.Directory+"/", old_dir+"/", new_dir+"/", 1)
+		node_dir = strings.TrimSuffix(node_dir, "/")
+		sbd.NodeList[N].Directory = node_dir
+		if node_dir == new_dir {
+			continue
+		}
+		RewriteSandboxScripts(node_dir, "single", change_paths)
+		nd := common.ReadSandboxDescription(node_dir)
+		for M := range nd.NodeList {
+			nd.NodeList[M].Directory = node_dir
+		}
+		common.WriteSandboxDescription(node_dir, nd)
+	}
+	RewriteSandboxScripts(new_dir, sbd.SBType, change_paths)
+	common.WriteSandboxDescription(new_dir, sbd)
+}
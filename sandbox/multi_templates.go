@@ -53,6 +53,12 @@ echo 'executing "send_kill" on node {{.Node}}'
 	clear_multi_template string = `#!/bin/sh
 {{.Copyright}}
 # Template : {{.TemplateName}}
+if [ -f {{.SandboxDir}}/no_clear ]
+then
+    echo "Sandbox {{.SandboxDir}} is locked. Command 'clear_all' refused"
+    echo "Run 'dbdeployer admin unlock' to remove the lock"
+    exit 1
+fi
 echo '# executing "clear"' on {{.SandboxDir}}
 {{range .Nodes}}
 echo 'executing "clear" on node {{.Node}}'
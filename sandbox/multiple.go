@@ -13,15 +13,41 @@ type Node struct {
 	Name     string
 }
 
+// Writes the scripts of a multiple sandbox, including
+// the shortcuts to each node (n1, n2, n3)
+func write_multiple_scripts(sandbox_dir string, data common.Smap) {
+	write_script(MultipleTemplates, "start_all", "start_multi_template", sandbox_dir, data, true)
+	write_script(MultipleTemplates, "restart_all", "restart_multi_template", sandbox_dir, data, true)
+	write_script(MultipleTemplates, "status_all", "status_multi_template", sandbox_dir, data, true)
+	write_script(MultipleTemplates, "test_sb_all", "test_sb_multi_template", sandbox_dir, data, true)
+	write_script(MultipleTemplates, "stop_all", "stop_multi_template", sandbox_dir, data, true)
+	write_script(MultipleTemplates, "send_kill_all", "send_kill_multi_template", sandbox_dir, data, true)
+	write_script(MultipleTemplates, "clear_all", "clear_multi_template", sandbox_dir, data, true)
+	write_script(MultipleTemplates, "use_all", "use_multi_template", sandbox_dir, data, true)
+	write_node_scripts(sandbox_dir, data)
+}
+
+// Writes the n1, n2, n3 scripts
+func write_node_scripts(sandbox_dir string, data common.Smap) {
+	for _, node := range data["Nodes"].([]common.Smap) {
+		var data_node common.Smap = common.Smap{
+			"Node":       node["Node"],
+			"SandboxDir": sandbox_dir,
+			"Copyright":  data["Copyright"],
+		}
+		write_script(MultipleTemplates, fmt.Sprintf("n%v", node["Node"]), "node_template", sandbox_dir, data_node, true)
+	}
+}
+
 func CreateMultipleSandbox(sdef SandboxDef, origin string, nodes int) {
 
-	Basedir := sdef.Basedir + "/" + sdef.Version
+	Basedir := SandboxBasedir(sdef)
 	if !common.DirExists(Basedir) {
 		fmt.Printf("Base directory %s does not exist\n", Basedir)
 		os.Exit(1)
 	}
 	if sdef.DirName == "" {
-		sdef.SandboxDir += "/" + MultiplePrefix + VersionToName(origin)
+		sdef.SandboxDir += "/" + MultiplePrefix + version_name(sdef)
 	} else {
 		sdef.SandboxDir += "/" + sdef.DirName
 	}
@@ -49,6 +75,9 @@ func CreateMultipleSandbox(sdef SandboxDef, origin string, nodes int) {
 		"Nodes":      []common.Smap{},
 	}
 
+	sdef.SBType = "multiple-node"
+	sdef.NodeRole = "node"
+	var node_names []string
 	for i := 1; i <= nodes; i++ {
 		data["Nodes"] = append(data["Nodes"].([]common.Smap), common.Smap{
 			"Node":       i,
@@ -56,36 +85,34 @@ func CreateMultipleSandbox(sdef SandboxDef, origin string, nodes int) {
 		})
 		sdef.LoadGrants = true
 		sdef.DirName = fmt.Sprintf("node%d", i)
+		node_names = append(node_names, sdef.DirName)
 		sdef.Port = base_port + i + 1
 		sdef.ServerId = (base_server_id + i) * 100
+		sdef.GtidDomainId = i
 		fmt.Printf("Installing and starting node %d\n", i)
 		sdef.Multi = true
 		sdef.Prompt = fmt.Sprintf("node%d", i)
 		CreateSingleSandbox(sdef, origin)
-		var data_node common.Smap = common.Smap{
-			"Node":       i,
-			"SandboxDir": sdef.SandboxDir,
-			"Copyright":  Copyright,
-		}
-		write_script(MultipleTemplates, fmt.Sprintf("n%d", i), "node_template", sdef.SandboxDir, data_node, true)
 	}
-	sdef.SBType = "multiple-node"
 	sb_desc := common.SandboxDescription{
-		Basedir: Basedir,
-		SBType:  "multiple",
-		Version: sdef.Version,
-		Port:    []int{0},
-		Nodes:   nodes,
+		Basedir:     Basedir,
+		SBType:      "multiple",
+		Version:     sdef.Version,
+		Flavor:      sdef.Flavor,
+		Port:        []int{0},
+		Nodes:       nodes,
+		CommandLine: sdef.CommandLine,
+		Flags:       sdef.Flags,
+		DbUser:      sdef.DbUser,
+		RplUser:     sdef.RplUser,
+		RplPassword: sdef.RplPassword,
+		NodeList:    collect_nodes(sdef.SandboxDir, node_names),
 	}
 	common.WriteSandboxDescription(sdef.SandboxDir, sb_desc)
+	common.UpdateCatalog(common.SandboxItemFromDir(sdef.SandboxDir))
 
-	write_script(MultipleTemplates, "start_all", "start_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "restart_all", "restart_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "status_all", "status_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "test_sb_all", "test_sb_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "stop_all", "stop_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "send_kill_all", "send_kill_multi_template", sdef.SandboxDir, data, true)
-	write_script(MultipleTemplates, "use_all", "use_multi_template", sdef.SandboxDir, data, true)
+	write_multiple_scripts(sdef.SandboxDir, data)
+	save_template_data(sdef.SandboxDir, data)
 	fmt.Printf("Multiple directory installed in %s\n", sdef.SandboxDir)
 	fmt.Printf("run 'dbdeployer usage multiple' for basic instructions'\n")
 }
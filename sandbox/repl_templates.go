@@ -17,8 +17,28 @@ then
 	# First run: root is running without password
 	export NOPASSWORD=1
 fi
-echo 'CHANGE MASTER TO  master_host="127.0.0.1",  master_port={{.MasterPort}},  master_user="{{.RplUser}}",  master_password="{{.RplPassword}}" ' | {{.SandboxDir}}/node{{.Node}}/use -u root
-{{.SandboxDir}}/node{{.Node}}/use -u root -e 'START SLAVE'
+echo '{{$.ChangeMasterTo}}  {{$.MasterHostParam}}="127.0.0.1",  {{$.MasterPortParam}}={{.MasterPort}},  {{$.MasterUserParam}}="{{.RplUser}}",  {{$.MasterPasswordParam}}="{{.RplPassword}}" ' | {{.SandboxDir}}/node{{.Node}}/use -u root
+{{.SandboxDir}}/node{{.Node}}/use -u root -e '{{$.StartSlave}}'
+
+{{end}}
+`
+	init_slaves_mariadb_template string = `#!/bin/sh
+{{.Copyright}}
+# Template : {{.TemplateName}}
+
+# Don't use directly.
+# This script is called by 'start_all' when needed
+# Slaves start from their GTID position (gtid_slave_pos)
+
+{{ range .Slaves }}
+echo "initializing slave {{.Node}}"
+if [ ! -f needs_initialization ]
+then
+	# First run: root is running without password
+	export NOPASSWORD=1
+fi
+echo '{{$.ChangeMasterTo}}  {{$.MasterHostParam}}="127.0.0.1",  {{$.MasterPortParam}}={{.MasterPort}},  {{$.MasterUserParam}}="{{.RplUser}}",  {{$.MasterPasswordParam}}="{{.RplPassword}}",  master_use_gtid=slave_pos ' | {{.SandboxDir}}/node{{.Node}}/use -u root
+{{.SandboxDir}}/node{{.Node}}/use -u root -e '{{$.StartSlave}}'
 
 {{end}}
 `
@@ -34,7 +54,7 @@ echo 'executing "start" on slave {{.Node}}'
 {{end}}
 if [ -f {{.SandboxDir}}/needs_initialization ] 
 then
-	{{.SandboxDir}}/initialize_slaves
+	{{.SandboxDir}}/{{.InitSlavesScript}}
     rm -f {{.SandboxDir}}/needs_initialization
 fi
 `
@@ -86,6 +106,12 @@ echo 'executing "send_kill" on master'
 	clear_all_template string = `#!/bin/sh
 {{.Copyright}}
 # Template : {{.TemplateName}}
+if [ -f {{.SandboxDir}}/no_clear ]
+then
+    echo "Sandbox {{.SandboxDir}} is locked. Command 'clear_all' refused"
+    echo "Run 'dbdeployer admin unlock' to remove the lock"
+    exit 1
+fi
 echo '# executing "clear"' on {{.SandboxDir}}
 {{range .Slaves}}
 echo 'executing "clear" on slave {{.Node}}'
@@ -127,11 +153,25 @@ if [ "$exit_code" != "0" ] ; then exit $exit_code ; fi
 # Template : {{.TemplateName}}
 echo "master"
 {{.SandboxDir}}/master/use -BN -e "select CONCAT('port: ', @@port) AS port"
-{{.SandboxDir}}/master/use -e 'show master status\G' | grep "File\|Position\|Executed"
+{{.SandboxDir}}/master/use -e '{{.ShowMasterStatus}}\G' | grep "File\|Position\|Executed"
+{{ range .Slaves }}
+echo "Slave{{.Node}}"
+{{.SandboxDir}}/node{{.Node}}/use -BN -e "select CONCAT('port: ', @@port) AS port"
+{{.SandboxDir}}/node{{.Node}}/use -e '{{$.ShowSlaveStatus}}\G' | grep "\(Running:\|{{$.MasterLabel}}_Log_Pos\|\<{{$.MasterLabel}}_Log_File\|Retrieved\|Executed\)"
+{{end}}
+`
+	check_slaves_mariadb_template string = `#!/bin/sh
+{{.Copyright}}
+# Template : {{.TemplateName}}
+echo "master"
+{{.SandboxDir}}/master/use -BN -e "select CONCAT('port: ', @@port) AS port"
+{{.SandboxDir}}/master/use -e '{{.ShowMasterStatus}}\G' | grep "File\|Position"
+{{.SandboxDir}}/master/use -BN -e "select CONCAT('gtid_binlog_pos: ', @@gtid_binlog_pos)"
 {{ range .Slaves }}
 echo "Slave{{.Node}}"
 {{.SandboxDir}}/node{{.Node}}/use -BN -e "select CONCAT('port: ', @@port) AS port"
-{{.SandboxDir}}/node{{.Node}}/use -e 'show slave status\G' | grep "\(Running:\|Master_Log_Pos\|\<Master_Log_File\|Retrieved\|Executed\)"
+{{.SandboxDir}}/node{{.Node}}/use -e '{{$.ShowSlaveStatus}}\G' | grep "\(Running:\|Master_Log_Pos\|\<Master_Log_File\|Using_Gtid\|Gtid_IO_Pos\)"
+{{.SandboxDir}}/node{{.Node}}/use -BN -e "select CONCAT('gtid_slave_pos: ', @@gtid_slave_pos)"
 {{end}}
 `
 	master_template string = `#!/bin/sh
@@ -152,9 +192,9 @@ echo "Slave{{.Node}}"
 SBDIR={{.SandboxDir}}
 cd $SBDIR
 
-if [ -x ./m ]
+if [ -x ./{{.MasterAbbr}} ]
 then
-    MASTER=./m
+    MASTER=./{{.MasterAbbr}}
 elif [ -x ./n1 ]
 then
     MASTER=./n1
@@ -177,7 +217,7 @@ MASTER_RECS=$($MASTER -BN -e 'select count(*) from test.t1')
 
 master_status=master_status$$
 slave_status=slave_status$$
-$MASTER -e 'show master status\G' > $master_status
+$MASTER -e '{{.ShowMasterStatus}}\G' > $master_status
 master_binlog=$(grep 'File:' $master_status | awk '{print $2}' )
 master_pos=$(grep 'Position:' $master_status | awk '{print $2}' )
 echo "# Master log: $master_binlog - Position: $master_pos - Rows: $MASTER_RECS"
@@ -228,9 +268,9 @@ for SLAVE_N in 1 2 3 4 5 6 7 8 9
 do
     N=$(($SLAVE_N+1)) 
     unset SLAVE
-    if [ -x ./s$SLAVE_N ]
+    if [ -x ./{{.SlaveAbbr}}$SLAVE_N ]
     then
-        SLAVE=./s$SLAVE_N
+        SLAVE=./{{.SlaveAbbr}}$SLAVE_N
     elif [ -x ./n$N ]
     then
         SLAVE=./n$N
@@ -242,8 +282,8 @@ do
         then
             sleep 3
         else
-            S_READY=$($SLAVE -BN -e "select master_pos_wait('$master_binlog', $master_pos,60)")
-            # master_pos_wait can return 0 or a positive number for successful replication
+            S_READY=$($SLAVE -BN -e "select {{.MasterPosWait}}('$master_binlog', $master_pos,60)")
+            # {{.MasterPosWait}} can return 0 or a positive number for successful replication
             # Any result that is not NULL or -1 is acceptable
             if [ "$S_READY" != "-1" -a "$S_READY" != "NULL" ]
             then
@@ -251,12 +291,12 @@ do
             fi
             ok_equal $S_READY 0 "Slave #$SLAVE_N acknowledged reception of transactions from master" 
         fi
-		if [ -f initialize_slaves ]
+		if [ -f {{.InitSlavesScript}} ]
 		then
-			$SLAVE -e 'show slave status\G' > $slave_status
-			IO_RUNNING=$(grep -w Slave_IO_Running $slave_status | awk '{print $2}')
+			$SLAVE -e '{{.ShowSlaveStatus}}\G' > $slave_status
+			IO_RUNNING=$(grep -w {{.SlaveLabel}}_IO_Running $slave_status | awk '{print $2}')
 			ok_equal $IO_RUNNING Yes "Slave #$SLAVE_N IO thread is running"
-			SQL_RUNNING=$(grep -w Slave_IO_Running $slave_status | awk '{print $2}')
+			SQL_RUNNING=$(grep -w {{.SlaveLabel}}_SQL_Running $slave_status | awk '{print $2}')
 			ok_equal $SQL_RUNNING Yes "Slave #$SLAVE_N SQL thread is running"
 			rm -f $slave_status 
 		fi
@@ -278,6 +318,11 @@ test_summary
 			Notes:       "Can also be run after calling './clear_all'",
 			Contents:    init_slaves_template,
 		},
+		"init_slaves_mariadb_template": TemplateDesc{
+			Description: "Initialize MariaDB slaves after deployment, using GTID",
+			Notes:       "Can also be run after calling './clear_all'",
+			Contents:    init_slaves_mariadb_template,
+		},
 		"start_all_template": TemplateDesc{
 			Description: "Starts nodes in replication order (with optional mysqld arguments)",
 			Notes:       "",
@@ -328,6 +373,11 @@ test_summary
 			Notes:       "",
 			Contents:    check_slaves_template,
 		},
+		"check_slaves_mariadb_template": TemplateDesc{
+			Description: "Checks replication status in MariaDB master and slaves",
+			Notes:       "",
+			Contents:    check_slaves_mariadb_template,
+		},
 		"master_template": TemplateDesc{
 			Description: "Runs the MySQL client for the master",
 			Notes:       "",
@@ -14,6 +14,96 @@ type Slave struct {
 	MasterPort int
 }
 
+const (
+	LegacyTerminology string = "legacy"
+	NewTerminology    string = "new"
+)
+
+// Returns the SQL statements and the status labels used to handle replication,
+// according to the server flavor and version.
+// Starting with MySQL 8.0.22, SLAVE and MASTER are replaced by REPLICA and SOURCE.
+// The old statements are deprecated and will be removed in future versions.
+func ReplicationCommands(flavor, version string) common.Smap {
+	commands := common.Smap{
+		"ChangeMasterTo":      "CHANGE MASTER TO",
+		"MasterHostParam":     "master_host",
+		"MasterPortParam":     "master_port",
+		"MasterUserParam":     "master_user",
+		"MasterPasswordParam": "master_password",
+		"MasterLogFileParam":  "master_log_file",
+		"MasterLogPosParam":   "master_log_pos",
+		"StartSlave":          "START SLAVE",
+		"StopSlave":           "STOP SLAVE",
+		"ResetSlave":          "RESET SLAVE",
+		"ShowSlaveStatus":     "SHOW SLAVE STATUS",
+		"ShowMasterStatus":    "SHOW MASTER STATUS",
+		"ResetMaster":         "RESET MASTER",
+		"MasterPosWait":       "master_pos_wait",
+		"SlaveLabel":          "Slave",
+		"MasterLabel":         "Master",
+		"SkipSlaveStart":      "--skip-slave-start",
+	}
+	if HasCapability(flavor, ReplicaStatements, version) {
+		commands["StartSlave"] = "START REPLICA"
+		commands["StopSlave"] = "STOP REPLICA"
+		commands["ResetSlave"] = "RESET REPLICA"
+		commands["ShowSlaveStatus"] = "SHOW REPLICA STATUS"
+		commands["SlaveLabel"] = "Replica"
+		commands["MasterLabel"] = "Source"
+	}
+	if HasCapability(flavor, ReplicationSourceTo, version) {
+		commands["ChangeMasterTo"] = "CHANGE REPLICATION SOURCE TO"
+		commands["MasterHostParam"] = "source_host"
+		commands["MasterPortParam"] = "source_port"
+		commands["MasterUserParam"] = "source_user"
+		commands["MasterPasswordParam"] = "source_password"
+		commands["MasterLogFileParam"] = "source_log_file"
+		commands["MasterLogPosParam"] = "source_log_pos"
+	}
+	if HasCapability(flavor, SourcePosWait, version) {
+		commands["MasterPosWait"] = "source_pos_wait"
+		commands["SkipSlaveStart"] = "--skip-replica-start"
+	}
+	if HasCapability(flavor, BinaryLogStatus, version) {
+		commands["ShowMasterStatus"] = "SHOW BINARY LOG STATUS"
+		commands["ResetMaster"] = "RESET BINARY LOGS AND GTIDS"
+	}
+	return commands
+}
+
+// Returns the names of the replication scripts for the given terminology.
+// The legacy terminology produces "m", "s1", "initialize_slaves",
+// while the new one produces "src", "r1", "initialize_replicas".
+func ReplicationScriptNames(terminology string) common.Smap {
+	switch terminology {
+	case NewTerminology:
+		return common.Smap{
+			"MasterAbbr":        "src",
+			"SlaveAbbr":         "r",
+			"InitSlavesScript":  "initialize_replicas",
+			"CheckSlavesScript": "check_replicas",
+		}
+	case LegacyTerminology, "":
+		return common.Smap{
+			"MasterAbbr":        "m",
+			"SlaveAbbr":         "s",
+			"InitSlavesScript":  "initialize_slaves",
+			"CheckSlavesScript": "check_slaves",
+		}
+	}
+	fmt.Printf("Unrecognized terminology '%s'. Accepted: '%s', '%s'\n", terminology, LegacyTerminology, NewTerminology)
+	os.Exit(1)
+	return nil
+}
+
+// Copies all the items from source into dest
+func merge_smap(dest, source common.Smap) common.Smap {
+	for k, v := range source {
+		dest[k] = v
+	}
+	return dest
+}
+
 func CreateMasterSlaveReplication(sdef SandboxDef, origin string, nodes int) {
 
 	sdef.ReplOptions = ReplOptions
@@ -43,16 +133,24 @@ func CreateMasterSlaveReplication(sdef SandboxDef, origin string, nodes int) {
 		os.Exit(1)
 	}
 	slaves := nodes - 1
+	script_names := ReplicationScriptNames(sdef.Terminology)
 	var data common.Smap = common.Smap{
 		"Copyright":  Copyright,
 		"SandboxDir": sdef.SandboxDir,
+		"Version":    sdef.Version,
+		"Flavor":     sdef.Flavor,
 		"Slaves":     []common.Smap{},
 	}
+	data = merge_smap(data, ReplicationCommands(sdef.Flavor, sdef.Version))
+	data = merge_smap(data, script_names)
 
 	fmt.Println("Installing and starting master")
 	sdef.LoadGrants = true
 	sdef.Multi = true
 	sdef.Prompt = "master"
+	sdef.SBType = "replication-node"
+	sdef.NodeRole = "master"
+	node_names := []string{"master"}
 	CreateSingleSandbox(sdef, origin)
 	for i := 1; i <= slaves; i++ {
 		data["Slaves"] = append(data["Slaves"].([]common.Smap), common.Smap{
@@ -66,47 +164,82 @@ func CreateMasterSlaveReplication(sdef SandboxDef, origin string, nodes int) {
 		sdef.DirName = fmt.Sprintf("node%d", i)
 		sdef.Port = base_port + i + 1
 		sdef.ServerId = (base_server_id + i + 1) * 100
+		sdef.NodeRole = "slave"
+		sdef.NodeMaster = "master"
+		node_names = append(node_names, sdef.DirName)
 		fmt.Printf("Installing and starting slave %d\n", i)
 		CreateSingleSandbox(sdef, origin)
-		var data_slave common.Smap = common.Smap{
-			"Node":       i,
-			"SandboxDir": sdef.SandboxDir,
-			"Copyright":  Copyright,
-		}
-		write_script(ReplicationTemplates, fmt.Sprintf("s%d", i), "slave_template", sdef.SandboxDir, data_slave, true)
-		write_script(ReplicationTemplates, fmt.Sprintf("n%d", i+1), "slave_template", sdef.SandboxDir, data_slave, true)
 	}
-	sdef.SBType = "replication-node"
 	sb_desc := common.SandboxDescription{
-		Basedir: sdef.Basedir + "/" + sdef.Version,
-		SBType:  "master-slave",
-		Version: sdef.Version,
-		Port:    []int{0},
-		Nodes:   slaves,
+		Basedir:     SandboxBasedir(sdef),
+		SBType:      "master-slave",
+		Version:     sdef.Version,
+		Flavor:      sdef.Flavor,
+		Port:        []int{0},
+		Nodes:       slaves,
+		CommandLine: sdef.CommandLine,
+		Flags:       sdef.Flags,
+		DbUser:      sdef.DbUser,
+		RplUser:     sdef.RplUser,
+		RplPassword: sdef.RplPassword,
+		NodeList:    collect_nodes(sdef.SandboxDir, node_names),
 	}
 	common.WriteSandboxDescription(sdef.SandboxDir, sb_desc)
+	common.UpdateCatalog(common.SandboxItemFromDir(sdef.SandboxDir))
 
-	write_script(ReplicationTemplates, "start_all", "start_all_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "restart_all", "restart_all_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "status_all", "status_all_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "test_sb_all", "test_sb_all_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "stop_all", "stop_all_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "send_kill_all", "send_kill_all_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "use_all", "use_all_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "initialize_slaves", "init_slaves_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "check_slaves", "check_slaves_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "m", "master_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "n1", "master_template", sdef.SandboxDir, data, true)
-	write_script(ReplicationTemplates, "test_replication", "test_replication_template", sdef.SandboxDir, data, true)
-	fmt.Println(sdef.SandboxDir + "/initialize_slaves")
-	common.Run_cmd(sdef.SandboxDir + "/initialize_slaves")
+	write_replication_scripts(sdef.SandboxDir, data)
+	save_template_data(sdef.SandboxDir, data)
+	initialize_slaves := sdef.SandboxDir + "/" + script_names["InitSlavesScript"].(string)
+	fmt.Println(initialize_slaves)
+	common.Run_cmd(initialize_slaves)
 	fmt.Printf("Replication directory installed in %s\n", sdef.SandboxDir)
 	fmt.Printf("run 'dbdeployer usage multiple' for basic instructions'\n")
 }
 
+// Returns the templates that initialize and check the slaves.
+// MariaDB slaves replicate using global transaction IDs.
+// Sandboxes created before flavors were detected use the generic ones.
+func slave_templates(data common.Smap) (init_template, check_template string) {
+	flavor, _ := data["Flavor"].(string)
+	version, _ := data["Version"].(string)
+	if HasCapability(flavor, MariaDBGtid, version) {
+		return "init_slaves_mariadb_template", "check_slaves_mariadb_template"
+	}
+	return "init_slaves_template", "check_slaves_template"
+}
+
+// Writes the scripts of a master-slave sandbox, including
+// the shortcuts to each node (m, s1, s2, n1, n2, n3)
+func write_replication_scripts(sandbox_dir string, data common.Smap) {
+	init_template, check_template := slave_templates(data)
+	write_script(ReplicationTemplates, "start_all", "start_all_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, "restart_all", "restart_all_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, "status_all", "status_all_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, "test_sb_all", "test_sb_all_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, "stop_all", "stop_all_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, "send_kill_all", "send_kill_all_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, "clear_all", "clear_all_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, "use_all", "use_all_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, data["InitSlavesScript"].(string), init_template, sandbox_dir, data, true)
+	write_script(ReplicationTemplates, data["CheckSlavesScript"].(string), check_template, sandbox_dir, data, true)
+	write_script(ReplicationTemplates, data["MasterAbbr"].(string), "master_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, "n1", "master_template", sandbox_dir, data, true)
+	write_script(ReplicationTemplates, "test_replication", "test_replication_template", sandbox_dir, data, true)
+	for _, slave := range data["Slaves"].([]common.Smap) {
+		var data_slave common.Smap = common.Smap{
+			"Node":       slave["Node"],
+			"SandboxDir": sandbox_dir,
+			"Copyright":  data["Copyright"],
+		}
+		node := slave["Node"].(int)
+		write_script(ReplicationTemplates, fmt.Sprintf("%s%d", data["SlaveAbbr"], node), "slave_template", sandbox_dir, data_slave, true)
+		write_script(ReplicationTemplates, fmt.Sprintf("n%d", node+1), "slave_template", sandbox_dir, data_slave, true)
+	}
+}
+
 func CreateReplicationSandbox(sdef SandboxDef, origin string, topology string, nodes int) {
 
-	Basedir := sdef.Basedir + "/" + sdef.Version
+	Basedir := SandboxBasedir(sdef)
 	if !common.DirExists(Basedir) {
 		fmt.Printf("Base directory %s does not exist\n", Basedir)
 		os.Exit(1)
@@ -115,15 +248,15 @@ func CreateReplicationSandbox(sdef SandboxDef, origin string, topology string, n
 	sandbox_dir := sdef.SandboxDir
 	switch topology {
 	case "master-slave":
-		sdef.SandboxDir += "/" + MasterSlavePrefix + VersionToName(origin)
+		sdef.SandboxDir += "/" + MasterSlavePrefix + version_name(sdef)
 	case "group":
 		if sdef.SinglePrimary {
-			sdef.SandboxDir += "/" + GroupSPPrefix + VersionToName(origin)
+			sdef.SandboxDir += "/" + GroupSPPrefix + version_name(sdef)
 		} else {
-			sdef.SandboxDir += "/" + GroupPrefix + VersionToName(origin)
+			sdef.SandboxDir += "/" + GroupPrefix + version_name(sdef)
 		}
-		if !GreaterOrEqualVersion(sdef.Version, []int{5, 7, 17}) {
-			fmt.Println("Group replication requires MySQL 5.7.17 or greater")
+		if !HasCapability(sdef.Flavor, GroupReplication, sdef.Version) {
+			fmt.Println("Group replication requires MySQL or Percona Server 5.7.17 or greater")
 			os.Exit(1)
 		}
 	default:
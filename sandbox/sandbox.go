@@ -16,7 +16,9 @@ type SandboxDef struct {
 	SBType         string
 	Multi          bool
 	Version        string
+	Flavor         string // detected from the binaries in a full base directory
 	Basedir        string
+	FullBasedir    bool // Basedir contains the binaries, instead of a directory per version
 	SandboxDir     string
 	LoadGrants     bool
 	InstalledPorts []int
@@ -38,6 +40,13 @@ type SandboxDef struct {
 	MyCnfOptions   []string
 	KeepAuthPlugin bool
 	SinglePrimary  bool
+	Terminology    string
+	NodeRole       string
+	NodeMaster     string
+	NodePeers      []string
+	GtidDomainId   int // MariaDB GTID domain, for servers that write independently
+	CommandLine    string
+	Flags          []string
 }
 
 const (
@@ -64,6 +73,12 @@ relay-log-info-repository=table
 gtid_mode=ON
 log-slave-updates
 enforce-gtid-consistency
+`
+	// MariaDB has GTIDs always enabled. These options make slaves
+	// log the transactions they receive, and reject out of order GTIDs.
+	MariaDBGtidOptions string = `
+log-slave-updates
+gtid_strict_mode=ON
 `
 )
 
@@ -168,15 +183,31 @@ func GreaterOrEqualVersion(version string, compared_to []int) bool {
 	minor := verList[1]
 	rev := verList[2]
 
-	if major == 10 {
-		return false
-	}
 	sversion := fmt.Sprintf("%02d%02d%02d", major, minor, rev)
 	scompare := fmt.Sprintf("%02d%02d%02d", cmajor, cminor, crev)
 	// fmt.Printf("<%s><%s>\n", sversion, scompare)
 	return sversion >= scompare
 }
 
+// Returns the directory containing the binaries of the sandbox
+func SandboxBasedir(sdef SandboxDef) string {
+	if sdef.FullBasedir {
+		return sdef.Basedir
+	}
+	return sdef.Basedir + "/" + sdef.Version
+}
+
+// Returns the version as used in sandbox names, such as 5_7_21.
+// For a full base directory, the version is preceded by the prefix of
+// the flavor (ps5_7_21 for Percona Server), as in the names of the
+// directories where tarballs are unpacked.
+func version_name(sdef SandboxDef) string {
+	if sdef.FullBasedir {
+		return common.FlavorPrefixes[sdef.Flavor] + VersionToName(sdef.Version)
+	}
+	return VersionToName(sdef.Version)
+}
+
 func slice_to_text(s_array []string) string {
 	var text string = ""
 	for _, v := range s_array {
@@ -193,7 +224,7 @@ func slice_to_text(s_array []string) string {
 func CreateSingleSandbox(sdef SandboxDef, origin string) {
 
 	var sandbox_dir string
-	sdef.Basedir = sdef.Basedir + "/" + sdef.Version
+	sdef.Basedir = SandboxBasedir(sdef)
 	if !common.DirExists(sdef.Basedir) {
 		fmt.Printf("Base directory %s does not exist\n", sdef.Basedir)
 		os.Exit(1)
@@ -202,7 +233,7 @@ func CreateSingleSandbox(sdef SandboxDef, origin string) {
 	//fmt.Printf("origin: %s\n", origin)
 	//fmt.Printf("def: %#v\n", sdef)
 	// port = VersionToPort(sdef.Version)
-	version_fname := VersionToName(sdef.Version)
+	version_fname := version_name(sdef)
 	if sdef.Prompt == "" {
 		sdef.Prompt = "mysql"
 	}
@@ -220,7 +251,7 @@ func CreateSingleSandbox(sdef SandboxDef, origin string) {
 		fmt.Printf("TMP directory %s does not exist\n", global_tmp_dir)
 		os.Exit(1)
 	}
-	if GreaterOrEqualVersion(sdef.Version, []int{8, 0, 4}) {
+	if HasCapability(sdef.Flavor, CachingSha2Default, sdef.Version) {
 		if sdef.KeepAuthPlugin == false {
 			sdef.InitOptions = append(sdef.InitOptions, "--default_authentication_plugin=mysql_native_password")
 			sdef.MyCnfOptions = append(sdef.MyCnfOptions, "default_authentication_plugin=mysql_native_password")
@@ -234,6 +265,7 @@ func CreateSingleSandbox(sdef SandboxDef, origin string) {
 		"BasePort":     sdef.BasePort,
 		"Prompt":       sdef.Prompt,
 		"Version":      sdef.Version,
+		"Flavor":       sdef.Flavor,
 		"Datadir":      datadir,
 		"Tmpdir":       tmpdir,
 		"GlobalTmpDir": global_tmp_dir,
@@ -243,16 +275,24 @@ func CreateSingleSandbox(sdef SandboxDef, origin string) {
 		"RplPassword":  sdef.RplPassword,
 		"RemoteAccess": sdef.RemoteAccess,
 		"BindAddress":  sdef.BindAddress,
+		"Host":         connection_host(sdef.BindAddress),
 		"OsUser":       os.Getenv("USER"),
 		"ReplOptions":  sdef.ReplOptions,
 		"GtidOptions":  sdef.GtidOptions,
 		"ExtraOptions": slice_to_text(sdef.MyCnfOptions),
 	}
+	data = merge_smap(data, ReplicationCommands(sdef.Flavor, sdef.Version))
 	if sdef.ServerId > 0 {
 		data["ServerId"] = fmt.Sprintf("server-id=%d", sdef.ServerId)
 	} else {
 		data["ServerId"] = ""
 	}
+	// Kept apart from the server ID, which changes when the sandbox is cloned
+	if sdef.GtidDomainId > 0 && HasCapability(sdef.Flavor, MariaDBGtid, sdef.Version) {
+		data["GtidDomainId"] = fmt.Sprintf("gtid_domain_id=%d", sdef.GtidDomainId)
+	} else {
+		data["GtidDomainId"] = ""
+	}
 	if common.DirExists(sandbox_dir) {
 		fmt.Printf("Directory %s already exists\n", sandbox_dir)
 		os.Exit(1)
@@ -284,10 +324,15 @@ func CreateSingleSandbox(sdef SandboxDef, origin string) {
 	cmd_list = append(cmd_list, "--basedir="+sdef.Basedir)
 	cmd_list = append(cmd_list, "--datadir="+datadir)
 	cmd_list = append(cmd_list, "--tmpdir="+sandbox_dir+"/tmp")
-	if GreaterOrEqualVersion(sdef.Version, []int{5, 7, 0}) {
+	if HasCapability(sdef.Flavor, InitializeInsecure, sdef.Version) {
 		script = sdef.Basedir + "/bin/mysqld"
 		cmd_list = append(cmd_list, "--initialize-insecure")
 	}
+	// The sandbox scripts connect as root with a password, not
+	// as the operating system user
+	if HasCapability(sdef.Flavor, RootSocketAuth, sdef.Version) {
+		cmd_list = append(cmd_list, "--auth-root-authentication-method=normal")
+	}
 	// fmt.Printf("Script: %s\n", script)
 	if !common.ExecExists(script) {
 		fmt.Printf("Script '%s' not found\n", script)
@@ -325,22 +370,74 @@ func CreateSingleSandbox(sdef SandboxDef, origin string) {
 		// fmt.Printf("stderr: %s\n", stderr.String())
 	}
 
+	// The description is written before starting the server, so that
+	// the sandbox can be found and deleted even if the start fails
 	if sdef.SBType == "" {
 		sdef.SBType = "single"
 	}
+	if sdef.NodeRole == "" {
+		sdef.NodeRole = "single"
+	}
+	socket := fmt.Sprintf("%s/mysql_sandbox%d.sock", global_tmp_dir, sdef.Port)
 	sb_desc := common.SandboxDescription{
-		Basedir: sdef.Basedir,
-		SBType:  sdef.SBType,
-		Version: sdef.Version,
-		Port:    []int{sdef.Port},
-		Nodes:   0,
+		Basedir:     sdef.Basedir,
+		SBType:      sdef.SBType,
+		Version:     sdef.Version,
+		Flavor:      sdef.Flavor,
+		Port:        []int{sdef.Port},
+		Nodes:       0,
+		CommandLine: sdef.CommandLine,
+		Flags:       sdef.Flags,
+		DbUser:      sdef.DbUser,
+		RplUser:     sdef.RplUser,
+		RplPassword: sdef.RplPassword,
+		Socket:      socket,
+		ServerId:    sdef.ServerId,
+		// The server UUID is created during initialization (5.6+)
+		ServerUUID: common.ReadServerUUID(datadir),
 	}
 	if len(sdef.MorePorts) > 0 {
 		for _, port := range sdef.MorePorts {
 			sb_desc.Port = append(sb_desc.Port, port)
 		}
 	}
+	sb_desc.NodeList = []common.NodeDescription{
+		common.NodeDescription{
+			Name:       sdef.DirName,
+			Role:       sdef.NodeRole,
+			Directory:  sandbox_dir,
+			Port:       sb_desc.Port,
+			ServerId:   sb_desc.ServerId,
+			ServerUUID: sb_desc.ServerUUID,
+			Socket:     socket,
+			Master:     sdef.NodeMaster,
+			Peers:      sdef.NodePeers,
+		},
+	}
+	common.WriteSandboxDescription(sandbox_dir, sb_desc)
+	if !sdef.Multi {
+		common.UpdateCatalog(common.SandboxItemFromDir(sandbox_dir))
+	}
+
+	write_single_scripts(sandbox_dir, data)
+	save_template_data(sandbox_dir, data)
+
+	//common.Run_cmd(sandbox_dir + "/start", []string{})
+	common.Run_cmd(sandbox_dir + "/start")
+	if sdef.LoadGrants {
+		common.Run_cmd(sandbox_dir + "/load_grants")
+	}
+	// Servers that don't create their UUID during initialization
+	// create it when they start for the first time
+	sb_desc.ServerUUID = common.ReadServerUUID(datadir)
+	sb_desc.NodeList[0].ServerUUID = sb_desc.ServerUUID
 	common.WriteSandboxDescription(sandbox_dir, sb_desc)
+}
+
+// Writes the scripts and configuration files of a single sandbox.
+// Except for init_db, they can be written again at any time from
+// the saved template data (see RelocateSandbox.)
+func write_single_scripts(sandbox_dir string, data common.Smap) {
 	write_script(SingleTemplates, "start", "start_template", sandbox_dir, data, true)
 	write_script(SingleTemplates, "status", "status_template", sandbox_dir, data, true)
 	write_script(SingleTemplates, "stop", "stop_template", sandbox_dir, data, true)
@@ -356,18 +453,57 @@ func CreateSingleSandbox(sdef SandboxDef, origin string) {
 	write_script(SingleTemplates, "test_sb", "test_sb_template", sandbox_dir, data, true)
 
 	write_script(SingleTemplates, "my.sandbox.cnf", "my_cnf_template", sandbox_dir, data, false)
-	if GreaterOrEqualVersion(sdef.Version, []int{5, 7, 6}) {
+	// Sandboxes created before flavors were detected have no "Flavor"
+	flavor, _ := data["Flavor"].(string)
+	if HasCapability(flavor, MariaDBGrants, data["Version"].(string)) {
+		write_script(SingleTemplates, "grants.mysql", "grants_template_mariadb", sandbox_dir, data, false)
+	} else if HasCapability(flavor, CreateUserGrants, data["Version"].(string)) {
 		write_script(SingleTemplates, "grants.mysql", "grants_template57", sandbox_dir, data, false)
 	} else {
 		write_script(SingleTemplates, "grants.mysql", "grants_template5x", sandbox_dir, data, false)
 	}
 	write_script(SingleTemplates, "sb_include", "sb_include_template", sandbox_dir, data, false)
+	write_connection_info(sandbox_dir, data)
+}
 
-	//common.Run_cmd(sandbox_dir + "/start", []string{})
-	common.Run_cmd(sandbox_dir + "/start")
-	if sdef.LoadGrants {
-		common.Run_cmd(sandbox_dir + "/load_grants")
+// Returns the address that clients should use to reach the server
+func connection_host(bind_address string) string {
+	if bind_address == "" || bind_address == "0.0.0.0" || bind_address == "::" || bind_address == "*" {
+		return "127.0.0.1"
+	}
+	return bind_address
+}
+
+// Writes the connection snippets for several languages
+// in the connection_info directory of a sandbox
+func write_connection_info(sandbox_dir string, data common.Smap) {
+	connection_dir := sandbox_dir + "/connection_info"
+	if !common.DirExists(connection_dir) {
+		err := os.Mkdir(connection_dir, 0755)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	write_script(ConnectionTemplates, "connection.go", "connection_go_template", connection_dir, data, false)
+	write_script(ConnectionTemplates, "SandboxConnection.java", "connection_java_template", connection_dir, data, false)
+	write_script(ConnectionTemplates, "connection.py", "connection_python_template", connection_dir, data, true)
+	write_script(ConnectionTemplates, "connection.pl", "connection_perl_template", connection_dir, data, true)
+	write_script(ConnectionTemplates, "connection.php", "connection_php_template", connection_dir, data, false)
+	write_script(ConnectionTemplates, ".my.cnf", "connection_my_cnf_template", connection_dir, data, false)
+}
+
+// Collects the descriptions of the nodes in a composite sandbox.
+// Each node has already written its own sbdescription.json
+func collect_nodes(sandbox_dir string, node_names []string) []common.NodeDescription {
+	var nodes []common.NodeDescription
+	for _, node_name := range node_names {
+		nd := common.ReadSandboxDescription(sandbox_dir + "/" + node_name)
+		for _, node := range nd.NodeList {
+			nodes = append(nodes, node)
+		}
 	}
+	return nodes
 }
 
 func write_script(temp_var TemplateCollection, name, template_name, directory string, data common.Smap, make_executable bool) {
@@ -1,6 +1,13 @@
 package sandbox
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+)
 
 type version_port struct {
 	version string
@@ -42,3 +49,241 @@ func TestVersionToPort(t *testing.T) {
 		}
 	}
 }
+
+type version_command struct {
+	version  string
+	key      string
+	expected string
+}
+
+func TestReplicationCommands(t *testing.T) {
+	t.Parallel()
+	var commands []version_command = []version_command{
+		{"5.7.21", "ChangeMasterTo", "CHANGE MASTER TO"},
+		{"5.7.21", "StartSlave", "START SLAVE"},
+		{"8.0.21", "ShowSlaveStatus", "SHOW SLAVE STATUS"},
+		{"8.0.22", "ShowSlaveStatus", "SHOW REPLICA STATUS"},
+		{"8.0.22", "ChangeMasterTo", "CHANGE MASTER TO"},
+		{"8.0.23", "ChangeMasterTo", "CHANGE REPLICATION SOURCE TO"},
+		{"8.0.23", "MasterPortParam", "source_port"},
+		{"8.0.25", "MasterPosWait", "master_pos_wait"},
+		{"8.0.26", "MasterPosWait", "source_pos_wait"},
+		{"8.0.23", "MasterLogPosParam", "source_log_pos"},
+		{"8.0.25", "SkipSlaveStart", "--skip-slave-start"},
+		{"8.0.26", "SkipSlaveStart", "--skip-replica-start"},
+		{"8.0.33", "ShowMasterStatus", "SHOW MASTER STATUS"},
+		{"8.4.0", "ShowMasterStatus", "SHOW BINARY LOG STATUS"},
+		{"8.4.0", "ResetMaster", "RESET BINARY LOGS AND GTIDS"},
+	}
+	for _, vc := range commands {
+		found := ReplicationCommands(common.MySQLFlavor, vc.version)[vc.key]
+		if found == vc.expected {
+			t.Logf("ok     %-8s %-18s => %s\n", vc.version, vc.key, found)
+		} else {
+			t.Logf("NOT OK %-8s %-18s => %s (expected: %s)\n", vc.version, vc.key, found, vc.expected)
+			t.Fail()
+		}
+	}
+}
+
+// Template data saved in a sandbox must be read back with the same types,
+// and its paths must follow the sandbox when it is moved.
+func TestTemplateDataRelocation(t *testing.T) {
+	t.Parallel()
+	sandbox_dir, err := ioutil.TempDir("", "sbtemplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sandbox_dir)
+	old_dir := "/sandboxes/rsandbox_5_7_21"
+	save_template_data(sandbox_dir, common.Smap{
+		"SandboxDir": old_dir,
+		"Datadir":    old_dir + "/data",
+		"InitScript": "mysqld --datadir=" + old_dir + "/data --basedir=/opt/mysql/5.7.21",
+		"Other":      old_dir + "_2/data",
+		"Port":       5721,
+		"Slaves":     []common.Smap{{"Node": 1, "SandboxDir": old_dir}},
+	})
+	data := ReadTemplateData(sandbox_dir)
+	replace_template_paths(data, old_dir, "/new/msb")
+	var expected = []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{data["SandboxDir"], "/new/msb"},
+		{data["Datadir"], "/new/msb/data"},
+		{data["InitScript"], "mysqld --datadir=/new/msb/data --basedir=/opt/mysql/5.7.21"},
+		{data["Other"], old_dir + "_2/data"},
+		{data["Port"], 5721},
+		{data["Slaves"].([]common.Smap)[0]["Node"], 1},
+		{data["Slaves"].([]common.Smap)[0]["SandboxDir"], "/new/msb"},
+	}
+	for _, e := range expected {
+		if e.value == e.expected {
+			t.Logf("ok     %v\n", e.value)
+		} else {
+			t.Logf("NOT OK %v (expected: %v)\n", e.value, e.expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestUpgradeTemplateChanges(t *testing.T) {
+	data := common.Smap{
+		"Basedir":         "/opt/mysql/5.7.21",
+		"Version":         "5.7.21",
+		"InitScript":      "/opt/mysql/5.7.21/bin/mysqld \\\n\t--basedir=/opt/mysql/5.7.21 \\\n\t--initialize-insecure",
+		"ExtraOptions":    "",
+		"ChangeMasterTo":  "CHANGE MASTER TO",
+		"MasterPortParam": "master_port",
+	}
+	upgrade_template_changes(common.MySQLFlavor, "8.0.23", "/opt/mysql/8.0.23")(data)
+	var expected = []struct {
+		key      string
+		expected interface{}
+	}{
+		{"Basedir", "/opt/mysql/8.0.23"},
+		{"Version", "8.0.23"},
+		{"InitScript", "/opt/mysql/8.0.23/bin/mysqld \\\n\t--basedir=/opt/mysql/8.0.23 \\\n\t--initialize-insecure"},
+		{"ExtraOptions", "default_authentication_plugin=mysql_native_password\n"},
+		{"ChangeMasterTo", "CHANGE REPLICATION SOURCE TO"},
+		{"MasterPortParam", "source_port"},
+		{"StartSlave", nil},
+	}
+	for _, e := range expected {
+		if data[e.key] == e.expected {
+			t.Logf("ok     %-16s %v\n", e.key, data[e.key])
+		} else {
+			t.Logf("NOT OK %-16s %v (expected: %v)\n", e.key, data[e.key], e.expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestSandboxBasedirAndName(t *testing.T) {
+	var sdef_list = []struct {
+		sdef    SandboxDef
+		basedir string
+		name    string
+	}{
+		{SandboxDef{Basedir: "/opt/mysql", Version: "5.7.21"}, "/opt/mysql/5.7.21", "5_7_21"},
+		{SandboxDef{Basedir: "/opt/mysql", Version: "ps5.7.21"}, "/opt/mysql/ps5.7.21", "ps5_7_21"},
+		{SandboxDef{Basedir: "/usr/local/mysql", Version: "8.0.11", FullBasedir: true}, "/usr/local/mysql", "8_0_11"},
+		{SandboxDef{Basedir: "/usr", Version: "10.2.14", Flavor: common.MariaDBFlavor, FullBasedir: true}, "/usr", "ma10_2_14"},
+		{SandboxDef{Basedir: "/opt/mysql", Version: "ma10.2.14", Flavor: common.MariaDBFlavor}, "/opt/mysql/ma10.2.14", "ma10_2_14"},
+	}
+	for _, item := range sdef_list {
+		basedir := SandboxBasedir(item.sdef)
+		name := version_name(item.sdef)
+		if basedir == item.basedir && name == item.name {
+			t.Logf("ok     %-20s %-10s %s\n", basedir, name, item.sdef.Flavor)
+		} else {
+			t.Logf("NOT OK %-20s %-10s (expected: %s %s)\n", basedir, name, item.basedir, item.name)
+			t.Fail()
+		}
+	}
+}
+
+func TestHasCapability(t *testing.T) {
+	var capability_list = []struct {
+		flavor     string
+		capability string
+		version    string
+		expected   bool
+	}{
+		{common.MySQLFlavor, InitializeInsecure, "5.7.21", true},
+		{common.MySQLFlavor, InitializeInsecure, "5.6.41", false},
+		{"", InitializeInsecure, "8.0.11", true},
+		{common.PerconaFlavor, InitializeInsecure, "ps5.7.21", true},
+		{common.MariaDBFlavor, InitializeInsecure, "10.2.14", false},
+		{common.MariaDBFlavor, CachingSha2Default, "10.3.7", false},
+		{common.MySQLFlavor, CachingSha2Default, "8.0.4", true},
+		{common.MariaDBFlavor, MySQLGtid, "10.2.14", false},
+		{common.MySQLFlavor, MySQLGtid, "5.6.9", true},
+		{common.MariaDBFlavor, GroupReplication, "ma10.2.14", false},
+		{common.MySQLFlavor, GroupReplication, "5.7.16", false},
+		{common.MariaDBFlavor, ReplicaStatements, "10.5.1", false},
+		{common.MySQLFlavor, UpgradeAtStartup, "8.0.16", true},
+		{common.MariaDBFlavor, MariaDBGtid, "10.2.14", true},
+		{common.MariaDBFlavor, MariaDBGtid, "5.5.60", false},
+		{common.MySQLFlavor, MariaDBGtid, "8.0.11", false},
+		{common.MariaDBFlavor, RootSocketAuth, "10.4.3", true},
+		{common.MariaDBFlavor, RootSocketAuth, "10.3.7", false},
+		{common.MariaDBFlavor, MariaDBGrants, "10.2.14", true},
+		{common.MySQLFlavor, MariaDBGrants, "8.0.11", false},
+		{"", MariaDBGrants, "ma10.3.7", true},
+		{"", BinaryLogStatus, "ma10.5.1", false},
+		{"", ReplicaStatements, "ps8.0.22", true},
+		{common.MySQLFlavor, "no-such-capability", "8.0.16", false},
+	}
+	for _, item := range capability_list {
+		found := HasCapability(item.flavor, item.capability, item.version)
+		if found == item.expected {
+			t.Logf("ok     %-8s %-22s %-10s %v\n", item.flavor, item.capability, item.version, found)
+		} else {
+			t.Logf("NOT OK %-8s %-22s %-10s %v (expected: %v)\n", item.flavor, item.capability, item.version, found, item.expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestSlaveTemplates(t *testing.T) {
+	var template_list = []struct {
+		data           common.Smap
+		expected_init  string
+		expected_check string
+	}{
+		{common.Smap{"Flavor": common.MySQLFlavor, "Version": "5.7.21"}, "init_slaves_template", "check_slaves_template"},
+		{common.Smap{"Flavor": common.MariaDBFlavor, "Version": "10.2.14"}, "init_slaves_mariadb_template", "check_slaves_mariadb_template"},
+		{common.Smap{"Flavor": common.MariaDBFlavor, "Version": "5.5.60"}, "init_slaves_template", "check_slaves_template"},
+		{common.Smap{}, "init_slaves_template", "check_slaves_template"},
+	}
+	for _, item := range template_list {
+		init_template, check_template := slave_templates(item.data)
+		if init_template == item.expected_init && check_template == item.expected_check {
+			t.Logf("ok     %v %s %s\n", item.data, init_template, check_template)
+		} else {
+			t.Logf("NOT OK %v %s %s (expected: %s %s)\n", item.data, init_template, check_template, item.expected_init, item.expected_check)
+			t.Fail()
+		}
+	}
+}
+
+// A clone gets a new server ID, but a MariaDB node keeps its GTID domain
+func TestCloneTemplateChanges(t *testing.T) {
+	data := common.Smap{
+		"SandboxDir":   "/sandboxes/multi_msb_ma10_2_14/node2",
+		"Port":         14415,
+		"ServerId":     "server-id=200",
+		"GtidDomainId": "gtid_domain_id=2",
+		"ReplOptions":  "log-bin",
+	}
+	clone_template_changes("/sandboxes/multi_msb_ma10_2_14", "/sandboxes/clone", map[int]int{14415: 15000})(data)
+	my_cnf := common.Tprintf(my_cnf_template, data)
+	var expected = []struct {
+		label  string
+		result bool
+	}{
+		{"sandbox dir", data["SandboxDir"] == "/sandboxes/clone/node2"},
+		{"port", data["Port"] == 15000},
+		{"server id", strings.Contains(my_cnf, "\nserver-id=15000\n")},
+		{"gtid domain", strings.Contains(my_cnf, "\ngtid_domain_id=2\n")},
+	}
+	for _, e := range expected {
+		if e.result {
+			t.Logf("ok     %s\n", e.label)
+		} else {
+			t.Logf("NOT OK %s\n%s\n", e.label, my_cnf)
+			t.Fail()
+		}
+	}
+	// Data saved before the GTID domain was introduced
+	delete(data, "GtidDomainId")
+	my_cnf = common.Tprintf(my_cnf_template, data)
+	if !strings.Contains(my_cnf, "\nserver-id=15000\nlog-bin\n") {
+		t.Logf("NOT OK template data without GtidDomainId\n%s\n", my_cnf)
+		t.Fail()
+	} else {
+		t.Logf("ok     template data without GtidDomainId\n")
+	}
+}
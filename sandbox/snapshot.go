@@ -0,0 +1,233 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/unpack"
+)
+
+// Snapshots of a sandbox are stored in a directory next to it,
+// with the same name and this suffix.
+const SnapshotDirSuffix string = ".snapshots"
+
+// State of one server at the time of a snapshot
+type SnapshotNode struct {
+	Name         string `json:"name"`
+	DataDir      string `json:"data_dir"` // relative to the sandbox directory
+	GtidExecuted string `json:"gtid_executed"`
+}
+
+type SnapshotDescription struct {
+	Name      string         `json:"name"`
+	Sandbox   string         `json:"sandbox"`
+	Version   string         `json:"version"`
+	SBType    string         `json:"type"`
+	Timestamp string         `json:"timestamp"`
+	Size      int64          `json:"size"`
+	Nodes     []SnapshotNode `json:"nodes"`
+}
+
+func SnapshotDir(sandbox_dir string) string {
+	return sandbox_dir + SnapshotDirSuffix
+}
+
+func snapshot_archive(sandbox_dir, name string) string {
+	return SnapshotDir(sandbox_dir) + "/" + name + ".tar.gz"
+}
+
+func snapshot_metadata(sandbox_dir, name string) string {
+	return SnapshotDir(sandbox_dir) + "/" + name + ".json"
+}
+
+func SnapshotExists(sandbox_dir, name string) bool {
+	return common.FileExists(snapshot_metadata(sandbox_dir, name))
+}
+
+// Returns the servers of a sandbox, with their data directories
+// relative to the sandbox directory.
+func snapshot_nodes(sandbox_dir string) []SnapshotNode {
+	var nodes []SnapshotNode
+	for _, node_dir := range common.NodeDirs(common.SandboxItemFromDir(sandbox_dir)) {
+		relative, _ := filepath.Rel(sandbox_dir, node_dir+"/data")
+		nodes = append(nodes, SnapshotNode{Name: filepath.Base(node_dir), DataDir: relative})
+	}
+	return nodes
+}
+
+// Reads the set of executed GTIDs from a running server.
+// Returns an empty string if the server does not use GTIDs.
+func ReadGtidExecuted(node_dir string) string {
+	output, err := common.Run_cmd_output(node_dir+"/use", []string{"-BN", "-e", "SELECT @@global.gtid_executed"})
+	if err != nil {
+		return ""
+	}
+	// In batch mode, the new lines within a GTID set are escaped
+	return strings.Replace(strings.TrimSpace(output), "\\n", "", -1)
+}
+
+// Collects the GTID state of each server in a running sandbox,
+// indexed by node name.
+func SandboxGtidState(sandbox_dir string) map[string]string {
+	gtids := make(map[string]string)
+	for _, node_dir := range common.NodeDirs(common.SandboxItemFromDir(sandbox_dir)) {
+		gtids[filepath.Base(node_dir)] = ReadGtidExecuted(node_dir)
+	}
+	return gtids
+}
+
+func write_snapshot_description(sandbox_dir string, snapshot SnapshotDescription) {
+	b, err := json.MarshalIndent(snapshot, " ", "\t")
+	if err != nil {
+		fmt.Println("error encoding snapshot description: ", err)
+		os.Exit(1)
+	}
+	err = common.WriteString(string(b), snapshot_metadata(sandbox_dir, snapshot.Name))
+	if err != nil {
+		fmt.Printf("error writing snapshot description: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func ReadSnapshot(sandbox_dir, name string) (snapshot SnapshotDescription) {
+	blob := common.SlurpAsBytes(snapshot_metadata(sandbox_dir, name))
+	err := json.Unmarshal(blob, &snapshot)
+	if err != nil {
+		fmt.Printf("error decoding snapshot description %s: %s\n", name, err)
+		os.Exit(1)
+	}
+	return
+}
+
+// Archives the data directories of a stopped sandbox.
+// The GTID state, collected before stopping the sandbox, is recorded
+// in the snapshot description.
+func TakeSnapshot(sandbox_dir, name string, gtids map[string]string) (SnapshotDescription, error) {
+	snapshot_dir := SnapshotDir(sandbox_dir)
+	if !common.DirExists(snapshot_dir) {
+		err := os.Mkdir(snapshot_dir, 0755)
+		if err != nil {
+			return SnapshotDescription{}, err
+		}
+	}
+	sbd := common.ReadSandboxDescription(sandbox_dir)
+	snapshot := SnapshotDescription{
+		Name:      name,
+		Sandbox:   filepath.Base(sandbox_dir),
+		Version:   sbd.Version,
+		SBType:    sbd.SBType,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Nodes:     snapshot_nodes(sandbox_dir),
+	}
+	var data_dirs []string
+	for N, node := range snapshot.Nodes {
+		snapshot.Nodes[N].GtidExecuted = gtids[node.Name]
+		data_dirs = append(data_dirs, node.DataDir)
+	}
+	archive := snapshot_archive(sandbox_dir, name)
+	err := common.CreateTarGz(archive, sandbox_dir, data_dirs)
+	if err != nil {
+		return snapshot, err
+	}
+	stat, err := os.Stat(archive)
+	if err == nil {
+		snapshot.Size = stat.Size()
+	}
+	write_snapshot_description(sandbox_dir, snapshot)
+	return snapshot, nil
+}
+
+// Returns the snapshots of a sandbox, sorted by time
+func ListSnapshots(sandbox_dir string) []SnapshotDescription {
+	var snapshots []SnapshotDescription
+	files, err := ioutil.ReadDir(SnapshotDir(sandbox_dir))
+	if err != nil {
+		return snapshots
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		snapshots = append(snapshots, ReadSnapshot(sandbox_dir, strings.TrimSuffix(file.Name(), ".json")))
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp < snapshots[j].Timestamp
+	})
+	return snapshots
+}
+
+// Replaces the data directories of a stopped sandbox with the ones
+// saved in a snapshot.
+// The current data directories are kept aside until the extraction
+// succeeds, and put back if it fails.
+func RestoreSnapshot(sandbox_dir, name string) error {
+	snapshot := ReadSnapshot(sandbox_dir, name)
+	archive := snapshot_archive(sandbox_dir, name)
+	if !common.FileExists(archive) {
+		return fmt.Errorf("archive %s not found", archive)
+	}
+	var moved []string
+	put_back := func() {
+		for _, data_dir := range moved {
+			os.RemoveAll(data_dir)
+			os.Rename(data_dir+".pre_restore", data_dir)
+		}
+	}
+	for _, node := range snapshot.Nodes {
+		data_dir := sandbox_dir + "/" + node.DataDir
+		if !common.DirExists(data_dir) {
+			continue
+		}
+		os.RemoveAll(data_dir + ".pre_restore")
+		err := os.Rename(data_dir, data_dir+".pre_restore")
+		if err != nil {
+			put_back()
+			return err
+		}
+		moved = append(moved, data_dir)
+	}
+	err := unpack.UnpackTar(archive, sandbox_dir, unpack.SILENT)
+	if err != nil {
+		put_back()
+		return err
+	}
+	for _, data_dir := range moved {
+		os.RemoveAll(data_dir + ".pre_restore")
+	}
+	return nil
+}
+
+func DeleteSnapshot(sandbox_dir, name string) error {
+	err := os.Remove(snapshot_archive(sandbox_dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Remove(snapshot_metadata(sandbox_dir, name))
+	if err != nil {
+		return err
+	}
+	// The directory is removed only when empty
+	os.Remove(SnapshotDir(sandbox_dir))
+	return nil
+}
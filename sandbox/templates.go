@@ -186,7 +186,7 @@ var (
 		then
 			if [ -f $SBDIR/data/master.info ]
 			then
-				echo "stop slave" | $SBDIR/use -u root
+				echo "{{.StopSlave}}" | $SBDIR/use -u root
 			fi
 			# echo "$MYSQL_ADMIN --defaults-file=$SBDIR/my.sandbox.cnf $MYCLIENT_OPTIONS shutdown"
 			$MYSQL_ADMIN --defaults-file=$SBDIR/my.sandbox.cnf $MYCLIENT_OPTIONS shutdown
@@ -215,6 +215,13 @@ var (
 		PIDFILE=$SBDIR/data/mysql_sandbox{{.Port}}.pid
 		cd $SBDIR
 
+		if [ -f $SBDIR/no_clear ]
+		then
+			echo "Sandbox $SBDIR is locked. Command 'clear' refused"
+			echo "Run 'dbdeployer admin unlock' to remove the lock"
+			exit 1
+		fi
+
 		#
 		# attempt to drop databases gracefully
 		#
@@ -238,7 +245,7 @@ var (
 			is_slave=$(ls data | grep relay)
 			if [ -n "$is_slave" ]
 			then
-				./use -e "stop slave; reset slave;"
+				./use -e "{{.StopSlave}}; {{.ResetSlave}};"
 			fi
 			if [[ "$VERSION" > "5.1" ]]
 			then
@@ -256,7 +263,7 @@ var (
 		is_master=$(ls data | grep 'mysql-bin')
 		if [ -n "$is_master" ]
 		then
-			./use -e 'reset master'
+			./use -e '{{.ResetMaster}}'
 		fi
 
 		./stop
@@ -301,7 +308,8 @@ pid-file           = {{.Datadir}}/mysql_sandbox{{.Port}}.pid
 bind-address       = {{.BindAddress}}
 log-error=msandbox.err
 {{.ServerId}}
-{{.ReplOptions}}
+{{if .GtidDomainId}}{{.GtidDomainId}}
+{{end}}{{.ReplOptions}}
 {{.GtidOptions}}
 
 {{.ExtraOptions}}
@@ -427,6 +435,39 @@ delete from user where password='';
 delete from db where user='';
 flush privileges;
 create database if not exists test;
+`
+	grants_template_mariadb string = `
+		# Template : {{.TemplateName}}
+use mysql;
+set password=password('{{.DbPassword}}');
+create user {{.DbUser}}@'{{.RemoteAccess}}' identified by '{{.DbPassword}}';
+grant all on *.* to {{.DbUser}}@'{{.RemoteAccess}}';
+create user {{.DbUser}}@'localhost' identified by '{{.DbPassword}}';
+grant all on *.* to {{.DbUser}}@'localhost';
+create user msandbox_rw@'localhost' identified by '{{.DbPassword}}';
+grant SELECT,INSERT,UPDATE,DELETE,CREATE,DROP,INDEX,ALTER,
+    SHOW DATABASES,CREATE TEMPORARY TABLES,LOCK TABLES, EXECUTE 
+    on *.* to msandbox_rw@'localhost';
+create user msandbox_rw@'{{.RemoteAccess}}' identified by '{{.DbPassword}}';
+grant SELECT,INSERT,UPDATE,DELETE,CREATE,DROP,INDEX,ALTER,
+    SHOW DATABASES,CREATE TEMPORARY TABLES,LOCK TABLES, EXECUTE 
+    on *.* to msandbox_rw@'{{.RemoteAccess}}';
+create user msandbox_ro@'{{.RemoteAccess}}' identified by '{{.DbPassword}}';
+grant SELECT,EXECUTE on *.* to msandbox_ro@'{{.RemoteAccess}}';
+create user msandbox_ro@'localhost' identified by '{{.DbPassword}}';
+grant SELECT,EXECUTE on *.* to msandbox_ro@'localhost';
+create user {{.RplUser}}@'{{.RemoteAccess}}' identified by '{{.RplPassword}}';
+grant REPLICATION SLAVE on *.* to {{.RplUser}}@'{{.RemoteAccess}}';
+-- Anonymous users. Since 10.4 mysql.user is a view, and they
+-- can only be removed with DROP USER
+set @anonymous = (select group_concat(concat("''@'", host, "'")) from mysql.user where user='');
+set @anonymous = ifnull(concat('drop user ', @anonymous), 'do 0');
+prepare drop_anonymous from @anonymous;
+execute drop_anonymous;
+deallocate prepare drop_anonymous;
+delete from db where user='';
+flush privileges;
+create database if not exists test;
 `
 	grants_template57 string = `
 
@@ -797,6 +838,11 @@ exit 0
 			Notes:       "",
 			Contents:    grants_template5x,
 		},
+		"grants_template_mariadb": TemplateDesc{
+			Description: "Grants for MariaDB sandboxes",
+			Notes:       "",
+			Contents:    grants_template_mariadb,
+		},
 		"grants_template57": TemplateDesc{
 			Description: "Grants for sandboxes from 5.7+",
 			Notes:       "",
@@ -838,5 +884,6 @@ exit 0
 		"multiple":    MultipleTemplates,
 		"replication": ReplicationTemplates,
 		"group":       GroupTemplates,
+		"connection":  ConnectionTemplates,
 	}
 )
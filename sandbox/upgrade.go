@@ -0,0 +1,151 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+)
+
+// Returns a function that changes the template data of a sandbox
+// for a new version of the server: base directory, version, and the
+// options and commands that depend on flavor and version.
+func upgrade_template_changes(new_flavor, new_version, new_basedir string) func(common.Smap) {
+	return func(data common.Smap) {
+		if old_basedir, ok := data["Basedir"].(string); ok {
+			replace_template_paths(data, old_basedir, new_basedir)
+			if init_script, ok := data["InitScript"].(string); ok {
+				data["InitScript"] = strings.Replace(init_script, "--basedir="+old_basedir+" ", "--basedir="+new_basedir+" ", -1)
+			}
+		}
+		old_version, _ := data["Version"].(string)
+		old_flavor, _ := data["Flavor"].(string)
+		if old_version != "" {
+			data["Version"] = new_version
+			data["Flavor"] = new_flavor
+		}
+		// Only the commands already used by the scripts are replaced
+		for key, value := range ReplicationCommands(new_flavor, new_version) {
+			if _, ok := data[key]; ok {
+				data[key] = value
+			}
+		}
+		// Same as in CreateSingleSandbox: the users created by the old
+		// version keep working with the new default authentication plugin
+		extra_options, ok := data["ExtraOptions"].(string)
+		if ok && old_version != "" && !HasCapability(old_flavor, CachingSha2Default, old_version) &&
+			HasCapability(new_flavor, CachingSha2Default, new_version) &&
+			!strings.Contains(extra_options, "default_authentication_plugin") {
+			data["ExtraOptions"] = extra_options + "default_authentication_plugin=mysql_native_password\n"
+		}
+	}
+}
+
+// Returns the nodes of a sandbox in the order they should be upgraded:
+// slaves before their master.
+func upgrade_order(sbd common.SandboxDescription) []common.NodeDescription {
+	var nodes []common.NodeDescription
+	var masters []common.NodeDescription
+	for _, node := range sbd.NodeList {
+		if node.Role == "master" {
+			masters = append(masters, node)
+		} else {
+			nodes = append(nodes, node)
+		}
+	}
+	return append(nodes, masters...)
+}
+
+func run_upgrade_step(script string, args ...string) error {
+	output, err := common.Run_cmd_output(script, args)
+	fmt.Print(output)
+	if err != nil {
+		return fmt.Errorf("error running %s: %s", script, err)
+	}
+	return nil
+}
+
+// Starts a node on the new binaries, upgrades its data directory,
+// and stops it again. The node is stopped also when a step fails.
+func upgrade_node(node common.NodeDescription, new_flavor, new_version string, commands common.Smap) error {
+	var err error
+	if node.Role == "slave" {
+		err = run_upgrade_step(node.Directory+"/start", commands["SkipSlaveStart"].(string))
+	} else {
+		err = run_upgrade_step(node.Directory + "/start")
+	}
+	if err == nil && !HasCapability(new_flavor, UpgradeAtStartup, new_version) {
+		err = run_upgrade_step(node.Directory+"/my", "sql_upgrade", "-u", "root")
+	}
+	stop_err := run_upgrade_step(node.Directory + "/stop")
+	if err == nil {
+		err = stop_err
+	}
+	return err
+}
+
+// Upgrades a stopped sandbox to a new version.
+// For each node (slaves first) the scripts are written again for the
+// new version, and the server is started, so that the data directory
+// is upgraded, and stopped again. Servers that don't upgrade at startup
+// (MySQL before 8.0.16) need an explicit run of mysql_upgrade.
+// Each node records the new version in its description once it is
+// upgraded, and is skipped when the upgrade is run again. If a node
+// fails, the upgrade stops, and the sandbox keeps the old version in
+// its description until all the nodes are upgraded.
+func UpgradeSandbox(sandbox_dir, new_version, new_basedir string) error {
+	new_flavor := common.DetectFlavor(new_basedir)
+	change := upgrade_template_changes(new_flavor, new_version, new_basedir)
+	commands := ReplicationCommands(new_flavor, new_version)
+	sbd := common.ReadSandboxDescription(sandbox_dir)
+	var upgraded []string
+	for _, node := range upgrade_order(sbd) {
+		if node.Directory != sandbox_dir {
+			nd := common.ReadSandboxDescription(node.Directory)
+			if nd.Version == new_version && nd.Basedir == new_basedir {
+				fmt.Printf("# %s was upgraded to %s already\n", node.Name, new_version)
+				continue
+			}
+		}
+		fmt.Printf("# Upgrading %s to %s\n", node.Name, new_version)
+		RewriteSandboxScripts(node.Directory, "single", change)
+		err := upgrade_node(node, new_flavor, new_version, commands)
+		if err != nil {
+			fmt.Printf("Upgrade of %s failed. Nodes upgraded: %d %s\n", node.Name, len(upgraded), strings.Join(upgraded, " "))
+			if sbd.Nodes > 0 {
+				fmt.Println("The upgraded nodes are skipped when the upgrade is run again")
+			}
+			return err
+		}
+		upgraded = append(upgraded, node.Name)
+		if node.Directory != sandbox_dir {
+			nd := common.ReadSandboxDescription(node.Directory)
+			nd.Version = new_version
+			nd.Flavor = new_flavor
+			nd.Basedir = new_basedir
+			common.WriteSandboxDescription(node.Directory, nd)
+		}
+	}
+	if sbd.Nodes > 0 {
+		RewriteSandboxScripts(sandbox_dir, sbd.SBType, change)
+	}
+	sbd.Version = new_version
+	sbd.Flavor = new_flavor
+	sbd.Basedir = new_basedir
+	common.WriteSandboxDescription(sandbox_dir, sbd)
+	return nil
+}
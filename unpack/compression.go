@@ -0,0 +1,116 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unpack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	NoCompression    = "none"
+	GzipCompression  = "gzip"
+	Bzip2Compression = "bzip2"
+	XzCompression    = "xz"
+	ZstdCompression  = "zstd"
+)
+
+// Suffixes of the archives and packages that can be extracted
+var ValidSuffixes = []string{
+	".tar",
+	".tar.gz", ".tgz",
+	".tar.bz2", ".tbz2", ".tbz",
+	".tar.xz", ".txz",
+	".tar.zst", ".tzst",
+	DebSuffix, RpmSuffix,
+}
+
+// The first bytes of each compressed format
+var compression_magic = []struct {
+	compression string
+	magic       []byte
+}{
+	{GzipCompression, []byte{0x1f, 0x8b}},
+	{Bzip2Compression, []byte("BZh")},
+	{XzCompression, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{ZstdCompression, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+func validSuffix(filename string) bool {
+	return ArchiveBaseName(filename) != ""
+}
+
+// Returns the name of an archive without its suffix,
+// or an empty string if the suffix is not recognized.
+func ArchiveBaseName(filename string) string {
+	for _, suffix := range ValidSuffixes {
+		if strings.HasSuffix(filename, suffix) && len(filename) > len(suffix) {
+			return strings.TrimSuffix(filename, suffix)
+		}
+	}
+	return ""
+}
+
+// Detects the compression of a stream from its first bytes.
+// Returns the compression and a reader that includes the bytes
+// used for the detection.
+func DetectCompression(stream io.Reader) (string, *bufio.Reader) {
+	reader := bufio.NewReader(stream)
+	for _, cm := range compression_magic {
+		header, err := reader.Peek(len(cm.magic))
+		if err == nil && bytes.Equal(header, cm.magic) {
+			return cm.compression, reader
+		}
+	}
+	return NoCompression, reader
+}
+
+// Returns a reader that decompresses the given stream, according to
+// the compression detected from its contents.
+// The returned function releases the resources of the decompressor.
+func decompressing_reader(stream io.Reader) (io.Reader, func(), error) {
+	compression, reader := DetectCompression(stream)
+	cond_print("Compression: "+compression, true, CHATTY)
+	switch compression {
+	case GzipCompression:
+		decompressor, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decompressor, func() { decompressor.Close() }, nil
+	case Bzip2Compression:
+		return bzip2.NewReader(reader), func() {}, nil
+	case XzCompression:
+		decompressor, err := xz.NewReader(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decompressor, func() {}, nil
+	case ZstdCompression:
+		decompressor, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decompressor, decompressor.Close, nil
+	}
+	return reader, func() {}, nil
+}
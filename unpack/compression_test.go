@@ -0,0 +1,126 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unpack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func make_tar(t *testing.T) []byte {
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	contents := []byte("#!/bin/sh\necho mysqld\n")
+	writer.WriteHeader(&tar.Header{Name: "mysql-8.0.11/bin/mysqld", Mode: 0755, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+	writer.Write(contents)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func compress(t *testing.T, compression string, data []byte) []byte {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	var err error
+	switch compression {
+	case GzipCompression:
+		writer = gzip.NewWriter(&buf)
+	case XzCompression:
+		writer, err = xz.NewWriter(&buf)
+	case ZstdCompression:
+		writer, err = zstd.NewWriter(&buf)
+	default:
+		return data
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(data)
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUnpackCompressions(t *testing.T) {
+	work_dir, err := ioutil.TempDir("", "unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(work_dir)
+	tar_data := make_tar(t)
+	var archive_list = []struct {
+		compression string
+		name        string
+	}{
+		{NoCompression, "plain.tar"},
+		{GzipCompression, "gzip.tar.gz"},
+		{XzCompression, "xz.tar.xz"},
+		{ZstdCompression, "zstd.tar.zst"},
+		// The suffix does not decide the compression
+		{XzCompression, "misnamed.tar.gz"},
+	}
+	for _, archive := range archive_list {
+		filename := work_dir + "/" + archive.name
+		destination := work_dir + "/" + archive.name + ".d"
+		os.Mkdir(destination, 0755)
+		ioutil.WriteFile(filename, compress(t, archive.compression, tar_data), 0644)
+
+		file, _ := os.Open(filename)
+		detected, _ := DetectCompression(file)
+		file.Close()
+		err = UnpackTar(filename, destination, SILENT)
+		_, stat_err := os.Stat(destination + "/mysql-8.0.11/bin/mysqld")
+		if detected == archive.compression && err == nil && stat_err == nil {
+			t.Logf("ok     %-20s %s\n", archive.name, detected)
+		} else {
+			t.Logf("NOT OK %-20s %s (expected: %s) %v %v\n", archive.name, detected, archive.compression, err, stat_err)
+			t.Fail()
+		}
+	}
+}
+
+func TestArchiveBaseName(t *testing.T) {
+	var name_list = []struct {
+		filename string
+		expected string
+	}{
+		{"mysql-8.0.11-linux-glibc2.12-x86_64.tar.xz", "mysql-8.0.11-linux-glibc2.12-x86_64"},
+		{"mysql-5.7.21-linux-glibc2.12-x86_64.tar.gz", "mysql-5.7.21-linux-glibc2.12-x86_64"},
+		{"mariadb-10.2.14-linux-x86_64.tgz", "mariadb-10.2.14-linux-x86_64"},
+		{"Percona-Server-5.7.21-20-Linux.x86_64.tar.bz2", "Percona-Server-5.7.21-20-Linux.x86_64"},
+		{"mysql-8.0.11.tar.zst", "mysql-8.0.11"},
+		{"mysql-8.0.11.zip", ""},
+		{".tar.gz", ""},
+	}
+	for _, item := range name_list {
+		found := ArchiveBaseName(item.filename)
+		if found == item.expected {
+			t.Logf("ok     %-50s %s\n", item.filename, found)
+		} else {
+			t.Logf("NOT OK %-50s %s (expected: %s)\n", item.filename, found, item.expected)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unpack
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DebSuffix = ".deb"
+	RpmSuffix = ".rpm"
+)
+
+// Tells whether the file is a .deb or .rpm package rather than a tarball
+func IsPackage(filename string) bool {
+	return strings.HasSuffix(filename, DebSuffix) || strings.HasSuffix(filename, RpmSuffix)
+}
+
+// Returns a reader for the data.tar.* member of a .deb package,
+// which is an "ar" archive.
+func deb_data_reader(stream io.Reader) (io.Reader, error) {
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(stream, magic); err != nil || string(magic) != "!<arch>\n" {
+		return nil, fmt.Errorf("not a .deb package (missing ar signature)")
+	}
+	header := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(stream, header); err != nil {
+			return nil, fmt.Errorf("data.tar member not found in .deb package")
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size for member %s of .deb package", name)
+		}
+		if strings.HasPrefix(name, "data.tar") {
+			return io.LimitReader(stream, size), nil
+		}
+		// Members are aligned to an even offset
+		if _, err = io.CopyN(ioutil.Discard, stream, size+size%2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Skips one header structure of an .rpm package.
+// The signature header is padded to a multiple of 8 bytes.
+func skip_rpm_header(stream io.Reader, padded bool) error {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(stream, intro); err != nil {
+		return err
+	}
+	if !bytes.Equal(intro[0:3], []byte{0x8e, 0xad, 0xe8}) {
+		return fmt.Errorf("invalid header in .rpm package")
+	}
+	index_count := int64(binary.BigEndian.Uint32(intro[8:12]))
+	data_size := int64(binary.BigEndian.Uint32(intro[12:16]))
+	size := index_count*16 + data_size
+	if padded {
+		size += (8 - (16+size)%8) % 8
+	}
+	_, err := io.CopyN(ioutil.Discard, stream, size)
+	return err
+}
+
+// Returns a reader for the payload of an .rpm package, which is a
+// compressed cpio archive following the lead, the signature, and
+// the header.
+func rpm_payload_reader(stream io.Reader) (io.Reader, error) {
+	lead := make([]byte, 96)
+	if _, err := io.ReadFull(stream, lead); err != nil || !bytes.Equal(lead[0:4], []byte{0xed, 0xab, 0xee, 0xdb}) {
+		return nil, fmt.Errorf("not an .rpm package (missing lead signature)")
+	}
+	if err := skip_rpm_header(stream, true); err != nil {
+		return nil, err
+	}
+	if err := skip_rpm_header(stream, false); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Reads a cpio archive in "newc" format, as found in .rpm packages,
+// presenting its entries as tar headers.
+type cpioReader struct {
+	stream   io.Reader
+	data     io.Reader
+	pending  []*tar.Header       // headers ready to be returned
+	links    map[string][]string // names waiting for the data of a hard link
+	seen     map[string]string   // first name with data for each inode
+	finished bool                // the trailer was read
+}
+
+func newCpioReader(stream io.Reader) *cpioReader {
+	return &cpioReader{
+		stream: stream,
+		links:  make(map[string][]string),
+		seen:   make(map[string]string),
+	}
+}
+
+func (r *cpioReader) Read(b []byte) (int, error) {
+	if r.data == nil {
+		return 0, io.EOF
+	}
+	return r.data.Read(b)
+}
+
+// Skips the padding that aligns names and data to 4 bytes
+func (r *cpioReader) skip_padding(size int64) error {
+	_, err := io.CopyN(ioutil.Discard, r.stream, (4-size%4)%4)
+	return err
+}
+
+func (r *cpioReader) Next() (*tar.Header, error) {
+	// Discards whatever was not read from the previous entry
+	if r.data != nil {
+		if _, err := io.Copy(ioutil.Discard, r.data); err != nil {
+			return nil, err
+		}
+		r.data = nil
+	}
+	if len(r.pending) > 0 {
+		header := r.pending[0]
+		r.pending = r.pending[1:]
+		return header, nil
+	}
+	if r.finished {
+		return nil, io.EOF
+	}
+	raw := make([]byte, 110)
+	if _, err := io.ReadFull(r.stream, raw); err != nil {
+		return nil, fmt.Errorf("truncated cpio archive")
+	}
+	magic := string(raw[0:6])
+	if magic != "070701" && magic != "070702" {
+		return nil, fmt.Errorf("unsupported cpio format (magic %s)", magic)
+	}
+	var fields [13]int64
+	for N := range fields {
+		value, err := strconv.ParseInt(string(raw[6+N*8:14+N*8]), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpio header")
+		}
+		fields[N] = value
+	}
+	inode, mode, nlink, mtime, size, name_size := fields[0], fields[1], fields[4], fields[5], fields[6], fields[11]
+	name_bytes := make([]byte, name_size)
+	if _, err := io.ReadFull(r.stream, name_bytes); err != nil {
+		return nil, err
+	}
+	if err := r.skip_padding(110 + name_size); err != nil {
+		return nil, err
+	}
+	name := strings.TrimRight(string(name_bytes), "\x00")
+	if name == "TRAILER!!!" {
+		// Hard links whose data never came are empty files
+		for _, names := range r.links {
+			for _, link_name := range names {
+				r.pending = append(r.pending, &tar.Header{Name: link_name, Typeflag: tar.TypeReg, Mode: 0644})
+			}
+		}
+		r.links = make(map[string][]string)
+		r.finished = true
+		return r.Next()
+	}
+	data := io.LimitReader(r.stream, size)
+	header := &tar.Header{
+		Name:    name,
+		Mode:    mode & 07777,
+		Size:    size,
+		ModTime: time.Unix(mtime, 0),
+	}
+	padding := func() error { return r.skip_padding(size) }
+	switch mode & 0170000 {
+	case 0040000:
+		header.Typeflag = tar.TypeDir
+	case 0120000:
+		target, err := ioutil.ReadAll(data)
+		if err != nil {
+			return nil, err
+		}
+		if err = padding(); err != nil {
+			return nil, err
+		}
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = string(target)
+		header.Size = 0
+	case 0100000:
+		header.Typeflag = tar.TypeReg
+		key := strconv.FormatInt(inode, 10)
+		if nlink > 1 {
+			if size == 0 {
+				// The data of hard links comes with the last of them
+				if target, ok := r.seen[key]; ok {
+					header.Typeflag = tar.TypeLink
+					header.Linkname = target
+				} else {
+					r.links[key] = append(r.links[key], name)
+					return r.Next()
+				}
+			} else {
+				r.seen[key] = name
+				for _, link_name := range r.links[key] {
+					r.pending = append(r.pending, &tar.Header{Name: link_name, Typeflag: tar.TypeLink, Linkname: name})
+				}
+				delete(r.links, key)
+			}
+		}
+		r.data = &padded_reader{data: data, padding: padding}
+	default:
+		header.Typeflag = tar.TypeChar // anything else is skipped
+		if _, err := io.Copy(ioutil.Discard, data); err != nil {
+			return nil, err
+		}
+		if err := padding(); err != nil {
+			return nil, err
+		}
+	}
+	return header, nil
+}
+
+// Reads the data of a cpio entry, and then skips its padding
+type padded_reader struct {
+	data    io.Reader
+	padding func() error
+	done    bool
+}
+
+func (p *padded_reader) Read(b []byte) (int, error) {
+	n, err := p.data.Read(b)
+	if err == io.EOF && !p.done {
+		p.done = true
+		if perr := p.padding(); perr != nil {
+			return n, perr
+		}
+	}
+	return n, err
+}
+
+// Where the directories of a package go in a sandbox binary directory,
+// in order. Patterns are relative to the extraction directory.
+var package_layout = []struct {
+	pattern     string
+	destination string
+}{
+	{"usr/sbin", "bin"},
+	{"usr/bin", "bin"},
+	{"usr/lib64/mysql", "lib"},
+	{"usr/lib/mysql", "lib"},
+	{"usr/lib64", "lib"},
+	{"usr/lib/*-linux-gnu", "lib"},
+	{"usr/share/mysql*", "share"},
+}
+
+func file_exists(filename string) bool {
+	_, err := os.Lstat(filename)
+	return err == nil
+}
+
+// Moves the contents of source into destination, merging directories
+func merge_dir(source, destination string) error {
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(source)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		from := filepath.Join(source, entry.Name())
+		to := filepath.Join(destination, entry.Name())
+		target, err := os.Lstat(to)
+		if err == nil && target.IsDir() && entry.IsDir() {
+			if err = merge_dir(from, to); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = os.Rename(from, to); err != nil {
+			return err
+		}
+	}
+	return os.Remove(source)
+}
+
+// Removes the directories left empty after moving their contents
+func remove_empty_dirs(dir string) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			remove_empty_dirs(filepath.Join(dir, entry.Name()))
+		}
+	}
+	// Fails, as intended, when the directory is not empty
+	os.Remove(dir)
+}
+
+// Rearranges the files of a .deb or .rpm package, extracted in
+// extract_dir, into the layout of a generic tarball:
+// usr/sbin and usr/bin go to bin/, the server libraries and plugins
+// go to lib/, and usr/share/mysql goes to share/.
+// Other files are left where they are.
+func ArrangePackageLayout(extract_dir string) error {
+	for _, item := range package_layout {
+		sources, err := filepath.Glob(filepath.Join(extract_dir, item.pattern))
+		if err != nil {
+			return err
+		}
+		for _, source := range sources {
+			if stat, err := os.Lstat(source); err != nil || !stat.IsDir() {
+				continue
+			}
+			cond_print(fmt.Sprintf("%s -> %s", source, item.destination), true, CHATTY)
+			if err = merge_dir(source, filepath.Join(extract_dir, item.destination)); err != nil {
+				return err
+			}
+		}
+	}
+	remove_empty_dirs(filepath.Join(extract_dir, "usr"))
+	if !file_exists(filepath.Join(extract_dir, "bin", "mysqld")) {
+		return fmt.Errorf("the package does not contain a server (mysqld not found)")
+	}
+	// Versions before 5.7 are initialized with scripts/mysql_install_db
+	install_db := filepath.Join(extract_dir, "bin", "mysql_install_db")
+	scripts_dir := filepath.Join(extract_dir, "scripts")
+	if file_exists(install_db) && !file_exists(scripts_dir) {
+		if err := os.Mkdir(scripts_dir, 0755); err != nil {
+			return err
+		}
+		return os.Symlink("../bin/mysql_install_db", filepath.Join(scripts_dir, "mysql_install_db"))
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unpack
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func write_ar(t *testing.T, filename string, members map[string][]byte, order []string) {
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	for _, name := range order {
+		data := members[name]
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", name+"/", 0, 0, 0, "100644", len(data))
+		buf.Write(data)
+		if len(data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type cpio_entry struct {
+	name  string
+	mode  int64
+	data  string
+	inode int64
+	nlink int64
+}
+
+func cpio_bytes(entries []cpio_entry) []byte {
+	var buf bytes.Buffer
+	pad := func() {
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	entries = append(entries, cpio_entry{name: "TRAILER!!!", nlink: 1})
+	for N, entry := range entries {
+		inode := entry.inode
+		if inode == 0 {
+			inode = int64(N + 100)
+		}
+		fmt.Fprintf(&buf, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+			inode, entry.mode, 0, 0, entry.nlink, 1520000000, len(entry.data),
+			0, 0, 0, 0, len(entry.name)+1, 0)
+		buf.WriteString(entry.name + "\x00")
+		pad()
+		buf.WriteString(entry.data)
+		pad()
+	}
+	return buf.Bytes()
+}
+
+func write_rpm(t *testing.T, filename string, payload []byte) {
+	var buf bytes.Buffer
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb})
+	buf.Write(lead)
+	rpm_header := func(index_count, data_size uint32, padded bool) {
+		buf.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+		binary.Write(&buf, binary.BigEndian, index_count)
+		binary.Write(&buf, binary.BigEndian, data_size)
+		buf.Write(make([]byte, index_count*16+data_size))
+		for padded && buf.Len()%8 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	rpm_header(1, 5, true)
+	rpm_header(2, 11, false)
+	buf.Write(payload)
+	if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func check_package_layout(t *testing.T, label, destination string) {
+	if err := ArrangePackageLayout(destination); err != nil {
+		t.Logf("NOT OK %s: %s\n", label, err)
+		t.Fail()
+		return
+	}
+	link, _ := os.Readlink(destination + "/lib/libmysqlclient.so")
+	original, _ := os.Stat(destination + "/bin/mysqld")
+	hardlink, _ := os.Stat(destination + "/bin/mysqld-copy")
+	var results = []struct {
+		label  string
+		result bool
+	}{
+		{"server in bin", file_exists(destination + "/bin/mysqld")},
+		{"client in bin", file_exists(destination + "/bin/mysqladmin")},
+		{"plugins in lib", file_exists(destination + "/lib/plugin/semisync_master.so")},
+		{"messages in share", file_exists(destination + "/share/english/errmsg.sys")},
+		{"symbolic link", link == "libmysqlclient.so.21"},
+		{"hard link", original != nil && hardlink != nil && os.SameFile(original, hardlink)},
+		{"other files", file_exists(destination + "/usr/share/doc/README")},
+		{"no usr/sbin", !file_exists(destination + "/usr/sbin")},
+		{"no empty usr/lib", !file_exists(destination + "/usr/lib")},
+	}
+	for _, r := range results {
+		if r.result {
+			t.Logf("ok     %s %s\n", label, r.label)
+		} else {
+			t.Logf("NOT OK %s %s\n", label, r.label)
+			t.Fail()
+		}
+	}
+}
+
+func TestUnpackPackages(t *testing.T) {
+	work_dir, err := ioutil.TempDir("", "unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(work_dir)
+
+	// .deb: an ar archive with a compressed data.tar
+	write_tar(t, work_dir+"/data.tar", []tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./usr/sbin/mysqld", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "./usr/sbin/mysqld-copy", Typeflag: tar.TypeLink, Linkname: "./usr/sbin/mysqld"},
+		{Name: "./usr/bin/mysqladmin", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "./usr/lib/mysql/plugin/semisync_master.so", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "./usr/lib/x86_64-linux-gnu/libmysqlclient.so.21", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "./usr/lib/x86_64-linux-gnu/libmysqlclient.so", Typeflag: tar.TypeSymlink, Linkname: "libmysqlclient.so.21"},
+		{Name: "./usr/share/mysql-8.0/english/errmsg.sys", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "./usr/share/doc/README", Typeflag: tar.TypeReg, Mode: 0644},
+	})
+	tar_data, _ := ioutil.ReadFile(work_dir + "/data.tar")
+	deb := work_dir + "/mysql-server_8.0.11-1_amd64.deb"
+	write_ar(t, deb, map[string][]byte{
+		"debian-binary":  []byte("2.0\n"),
+		"control.tar.gz": compress(t, GzipCompression, []byte("control")),
+		"data.tar.xz":    compress(t, XzCompression, tar_data),
+	}, []string{"debian-binary", "control.tar.gz", "data.tar.xz"})
+
+	// .rpm: lead, signature, header, and a compressed cpio payload
+	rpm := work_dir + "/mysql-server-8.0.11-1.el7.x86_64.rpm"
+	write_rpm(t, rpm, compress(t, GzipCompression, cpio_bytes([]cpio_entry{
+		{name: "./usr/sbin/mysqld-copy", mode: 0100755, inode: 7, nlink: 2},
+		{name: "./usr/sbin/mysqld", mode: 0100755, data: "mysqld", inode: 7, nlink: 2},
+		{name: "./usr/bin/mysqladmin", mode: 0100755, data: "admin", nlink: 1},
+		{name: "./usr/lib64/mysql", mode: 0040755, nlink: 2},
+		{name: "./usr/lib64/mysql/plugin/semisync_master.so", mode: 0100644, data: "so", nlink: 1},
+		{name: "./usr/lib64/mysql/libmysqlclient.so.21", mode: 0100644, data: "lib", nlink: 1},
+		{name: "./usr/lib64/mysql/libmysqlclient.so", mode: 0120777, data: "libmysqlclient.so.21", nlink: 1},
+		{name: "./usr/share/mysql/english/errmsg.sys", mode: 0100644, data: "errors", nlink: 1},
+		{name: "./usr/share/doc/README", mode: 0100644, data: "readme", nlink: 1},
+	})))
+
+	for _, filename := range []string{deb, rpm} {
+		destination := filename + ".d"
+		os.Mkdir(destination, 0755)
+		err = UnpackTar(filename, destination, SILENT)
+		if err != nil {
+			t.Logf("NOT OK %s: %s\n", filename, err)
+			t.Fail()
+			continue
+		}
+		check_package_layout(t, filename[len(work_dir)+1:], destination)
+	}
+}
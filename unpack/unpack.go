@@ -36,13 +36,16 @@ package unpack
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -53,6 +56,18 @@ const (
 
 var Verbose int
 
+// Entries skipped by a slim unpack: the test suite, debug binaries
+// and plugins, and static libraries, which are not needed to run
+// a sandbox but take most of the space of a tarball.
+var SlimExcludePatterns = []string{
+	"mysql-test",
+	"sql-bench",
+	"bin/mysqld-debug",
+	"lib/plugin/debug",
+	"lib/mysql/plugin/debug",
+	"*.a",
+}
+
 func cond_print(s string, nl bool, level int) {
 	if Verbose >= level {
 		if nl {
@@ -63,86 +78,247 @@ func cond_print(s string, nl bool, level int) {
 	}
 }
 
-func validSuffix(filename string) bool {
-	for _, suffix := range []string{".tgz", ".tar", ".tar.gz"} {
-		if strings.HasSuffix(filename, suffix) {
-			return true
-		}
-	}
-	return false
+func UnpackTar(filename string, destination string, verbosity_level int) (err error) {
+	return UnpackTarWithHash(filename, destination, verbosity_level, nil)
 }
 
-func UnpackTar(filename string, destination string, verbosity_level int) (err error) {
+// Extracts a tarball like UnpackTar, computing at the same time the
+// given hash of the whole file, so that the file is read only once.
+func UnpackTarWithHash(filename string, destination string, verbosity_level int, hasher hash.Hash) (err error) {
+	_, err = UnpackTarExcluding(filename, destination, verbosity_level, hasher, nil)
+	return err
+}
+
+// Extracts a tarball like UnpackTarWithHash, skipping the entries
+// that match any of the exclude patterns (see Excluded).
+// Returns the size of the files that were skipped.
+func UnpackTarExcluding(filename string, destination string, verbosity_level int, hasher hash.Hash, exclude []string) (saved int64, err error) {
 	Verbose = verbosity_level
+	for _, pattern := range exclude {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return 0, fmt.Errorf("invalid exclude pattern '%s': %s", pattern, err)
+		}
+	}
 	f, err := os.Stat(destination)
 	if os.IsNotExist(err) {
-		return fmt.Errorf("Destination directory '%s' does not exist", destination)
+		return 0, fmt.Errorf("Destination directory '%s' does not exist", destination)
 	}
 	filemode := f.Mode()
 	if filemode.IsDir() == false {
-		return fmt.Errorf("Destination '%s' is not a directory", destination)
+		return 0, fmt.Errorf("Destination '%s' is not a directory", destination)
 	}
 	if !validSuffix(filename) {
-		return fmt.Errorf("unrecognized archive suffix")
+		return 0, fmt.Errorf("unrecognized archive suffix")
 	}
 	var file *os.File
 	if file, err = os.Open(filename); err != nil {
-		return err
+		return 0, err
 	}
 	defer file.Close()
-	os.Chdir(destination)
-	var fileReader io.Reader = file
-	var decompressor *gzip.Reader
-	if strings.HasSuffix(filename, ".gz") {
-		if decompressor, err = gzip.NewReader(file); err != nil {
-			return err
+	var stream io.Reader = file
+	if hasher != nil {
+		stream = io.TeeReader(file, hasher)
+	}
+	// Packages contain a compressed archive after their own headers
+	var archive io.Reader = stream
+	switch {
+	case strings.HasSuffix(filename, DebSuffix):
+		archive, err = deb_data_reader(stream)
+	case strings.HasSuffix(filename, RpmSuffix):
+		archive, err = rpm_payload_reader(stream)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// The compression is detected from the contents, as the
+	// suffix may not match the actual format.
+	decompressor, close_decompressor, err := decompressing_reader(archive)
+	if err != nil {
+		return 0, err
+	}
+	defer close_decompressor()
+	// Files are extracted relative to the destination, without
+	// changing the working directory.
+	base_dir, err := filepath.EvalSymlinks(destination)
+	if err == nil {
+		base_dir, err = filepath.Abs(base_dir)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var reader archive_reader = tar.NewReader(decompressor)
+	if strings.HasSuffix(filename, RpmSuffix) {
+		reader = newCpioReader(decompressor)
+	}
+	saved, err = unpackTarFiles(reader, base_dir, exclude)
+	if err == nil && hasher != nil {
+		// The hash includes whatever follows the end of the archive
+		_, err = io.Copy(ioutil.Discard, stream)
+	}
+	return saved, err
+}
+
+// Returns the directory that holds the contents of an archive
+// extracted in extract_dir: the only top-level directory of the
+// archive, or extract_dir itself when the archive has several
+// entries at the top.
+func TopLevelDir(extract_dir string) (string, error) {
+	entries, err := ioutil.ReadDir(extract_dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("no files were extracted in %s", extract_dir)
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(extract_dir, entries[0].Name()), nil
+	}
+	return extract_dir, nil
+}
+
+// Makes sure that the target of a link, which is relative to
+// link_dir, does not point outside base_dir.
+// Links already extracted in the path of the link are followed.
+func checkLinkTarget(base_dir, link_dir, name, target string) error {
+	if path.IsAbs(target) {
+		return fmt.Errorf("link %s has an absolute target %s", name, target)
+	}
+	link_dir, err := filepath.EvalSymlinks(link_dir)
+	if err != nil {
+		return err
+	}
+	relative, err := filepath.Rel(base_dir, filepath.Join(link_dir, target))
+	if err != nil || relative == ".." || strings.HasPrefix(relative, "../") {
+		return fmt.Errorf("link %s points outside the destination (%s)", name, target)
+	}
+	return nil
+}
+
+// Tells whether an entry of the archive matches one of the patterns.
+// A pattern matches any sequence of components of the entry name,
+// so that "mysql-test" excludes a directory with that name and all its
+// contents, "bin/mysqld-debug" excludes that file, and "*.a" excludes
+// static libraries anywhere in the archive.
+func Excluded(name string, patterns []string) bool {
+	components := strings.Split(strings.TrimSuffix(name, "/"), "/")
+	for _, pattern := range patterns {
+		for start := range components {
+			for end := start + 1; end <= len(components); end++ {
+				matches, _ := path.Match(pattern, strings.Join(components[start:end], "/"))
+				if matches {
+					return true
+				}
+			}
 		}
-		defer decompressor.Close()
 	}
-	var reader *tar.Reader
-	if decompressor != nil {
-		reader = tar.NewReader(decompressor)
-	} else {
-		reader = tar.NewReader(fileReader)
+	return false
+}
+
+func makeParentDir(filename string) error {
+	fileDir := path.Dir(filename)
+	if _, err := os.Stat(fileDir); os.IsNotExist(err) {
+		if err = os.MkdirAll(fileDir, 0755); err != nil {
+			return err
+		}
+		cond_print(" + "+fileDir+" ", true, CHATTY)
 	}
-	return unpackTarFiles(reader)
+	return nil
+}
+
+// The entries of an archive: a tar file, or the cpio payload of a package
+type archive_reader interface {
+	io.Reader
+	Next() (*tar.Header, error)
 }
 
-func unpackTarFiles(reader *tar.Reader) (err error) {
+func unpackTarFiles(reader archive_reader, base_dir string, exclude []string) (saved int64, err error) {
 	var header *tar.Header
 	var count int = 0
+	var dirs, symlinks, hardlinks, skipped, excluded int
+	// The times of directories are set at the end, as the
+	// extraction of their contents changes them.
+	dir_times := make(map[string]time.Time)
 
 	for {
 		if header, err = reader.Next(); err != nil {
 			if err == io.EOF {
+				for dirname, mtime := range dir_times {
+					os.Chtimes(dirname, mtime, mtime)
+				}
 				cond_print("Files ", false, CHATTY)
 				cond_print(strconv.Itoa(count), true, 1)
-				return nil // OK
+				cond_print(fmt.Sprintf("Files: %d, directories: %d, symbolic links: %d, hard links: %d, skipped: %d",
+					count, dirs, symlinks, hardlinks, skipped), true, 1)
+				if len(exclude) > 0 {
+					cond_print(fmt.Sprintf("Excluded: %d entries, %d bytes", excluded, saved), true, 1)
+				}
+				return saved, nil // OK
 			}
-			return err
+			return saved, err
 		}
 		//fmt.Printf("%#v\n", header)
 		filemode := os.FileMode(header.Mode)
-		filename := sanitizedName(header.Name)
+		name := sanitizedName(header.Name)
+		if name == "" {
+			continue
+		}
+		// A hard link to an excluded file is excluded as well
+		if Excluded(name, exclude) ||
+			(header.Typeflag == tar.TypeLink && Excluded(sanitizedName(header.Linkname), exclude)) {
+			excluded++
+			if header.Typeflag == tar.TypeReg {
+				saved += header.Size
+			}
+			cond_print("excluded "+name, true, CHATTY)
+			continue
+		}
+		filename := filepath.Join(base_dir, name)
 		switch header.Typeflag {
 		case tar.TypeDir:
 			if err = os.MkdirAll(filename, 0755); err != nil {
-				return err
+				return saved, err
+			}
+			dirs++
+			dir_times[filename] = header.ModTime
+		case tar.TypeSymlink:
+			if err = makeParentDir(filename); err != nil {
+				return saved, err
 			}
+			if err = checkLinkTarget(base_dir, path.Dir(filename), name, header.Linkname); err != nil {
+				return saved, err
+			}
+			os.Remove(filename)
+			if err = os.Symlink(header.Linkname, filename); err != nil {
+				return saved, err
+			}
+			symlinks++
+			cond_print(name+" -> "+header.Linkname, true, CHATTY)
+		case tar.TypeLink:
+			// The target of a hard link is another entry of the archive
+			target := sanitizedName(header.Linkname)
+			if err = makeParentDir(filename); err != nil {
+				return saved, err
+			}
+			if err = checkLinkTarget(base_dir, base_dir, name, target); err != nil {
+				return saved, err
+			}
+			os.Remove(filename)
+			if err = os.Link(filepath.Join(base_dir, target), filename); err != nil {
+				return saved, err
+			}
+			hardlinks++
+			cond_print(name+" => "+target, true, CHATTY)
 		case tar.TypeReg:
-			fileDir := path.Dir(filename)
-			if _, err := os.Stat(fileDir); os.IsNotExist(err) {
-				if err = os.MkdirAll(fileDir, 0755); err != nil {
-					return err
-				}
-				cond_print(" + "+fileDir+" ", true, CHATTY)
+			if err = makeParentDir(filename); err != nil {
+				return saved, err
 			}
 			if err = unpackTarFile(filename, header.Name, reader); err != nil {
-				return err
+				return saved, err
 			}
 			os.Chmod(filename, filemode)
+			os.Chtimes(filename, header.ModTime, header.ModTime)
 			count++
-			cond_print(filename, true, CHATTY)
+			cond_print(name, true, CHATTY)
 			if count%10 == 0 {
 				mark := "."
 				if count%100 == 0 {
@@ -152,13 +328,16 @@ func unpackTarFiles(reader *tar.Reader) (err error) {
 					cond_print(mark, false, 1)
 				}
 			}
+		default:
+			skipped++
+			cond_print(fmt.Sprintf("skipped %s (type %c)", name, header.Typeflag), true, CHATTY)
 		}
 	}
-	return nil
+	return saved, nil
 }
 
 func unpackTarFile(filename, tarFilename string,
-	reader *tar.Reader) (err error) {
+	reader io.Reader) (err error) {
 	var writer *os.File
 	if writer, err = os.Create(filename); err != nil {
 		return err
@@ -0,0 +1,223 @@
+// Copyright © 2018 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unpack
+
+import (
+	"archive/tar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// Writes a tar file with the given headers. Regular files get
+// their name as contents.
+func write_tar(t *testing.T, filename string, headers []tar.Header) {
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := tar.NewWriter(file)
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(header.Name))
+		}
+		writer.WriteHeader(&header)
+		if header.Typeflag == tar.TypeReg {
+			writer.Write([]byte(header.Name))
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpackLinks(t *testing.T) {
+	work_dir, err := ioutil.TempDir("", "unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(work_dir)
+	mtime := time.Date(2018, 3, 4, 10, 20, 30, 0, time.UTC)
+	write_tar(t, work_dir+"/links.tar", []tar.Header{
+		{Name: "mysql/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime},
+		{Name: "mysql/lib/libmysqlclient.so.21", Typeflag: tar.TypeReg, Mode: 0644, ModTime: mtime},
+		{Name: "mysql/lib/libmysqlclient.so", Typeflag: tar.TypeSymlink, Linkname: "libmysqlclient.so.21"},
+		{Name: "mysql/bin/mysqld", Typeflag: tar.TypeReg, Mode: 0755, ModTime: mtime},
+		{Name: "mysql/bin/mysqld-debug", Typeflag: tar.TypeLink, Linkname: "mysql/bin/mysqld"},
+	})
+	destination := work_dir + "/ok"
+	os.Mkdir(destination, 0755)
+	err = UnpackTar(work_dir+"/links.tar", destination, SILENT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, _ := os.Readlink(destination + "/mysql/lib/libmysqlclient.so")
+	contents, _ := ioutil.ReadFile(destination + "/mysql/lib/libmysqlclient.so")
+	original, _ := os.Stat(destination + "/mysql/bin/mysqld")
+	hardlink, _ := os.Stat(destination + "/mysql/bin/mysqld-debug")
+	dir_stat, _ := os.Stat(destination + "/mysql")
+	var results = []struct {
+		label  string
+		result bool
+	}{
+		{"symbolic link", link == "libmysqlclient.so.21" && string(contents) == "mysql/lib/libmysqlclient.so.21"},
+		{"hard link", original != nil && hardlink != nil && os.SameFile(original, hardlink)},
+		{"file time", original != nil && original.ModTime().Equal(mtime)},
+		{"directory time", dir_stat != nil && dir_stat.ModTime().Equal(mtime)},
+	}
+	for _, r := range results {
+		if r.result {
+			t.Logf("ok     %s\n", r.label)
+		} else {
+			t.Logf("NOT OK %s\n", r.label)
+			t.Fail()
+		}
+	}
+
+	var escape_list = []struct {
+		label   string
+		headers []tar.Header
+	}{
+		{"absolute symlink", []tar.Header{
+			{Name: "mysql/passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}}},
+		{"relative symlink", []tar.Header{
+			{Name: "mysql/lib/up", Typeflag: tar.TypeSymlink, Linkname: "../../.."}}},
+		{"symlink through symlink", []tar.Header{
+			{Name: "here", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "here/up", Typeflag: tar.TypeSymlink, Linkname: ".."}}},
+	}
+	for N, escape := range escape_list {
+		filename := work_dir + "/escape.tar"
+		destination := fmt.Sprintf("%s/escape%d", work_dir, N)
+		os.Mkdir(destination, 0755)
+		write_tar(t, filename, escape.headers)
+		err = UnpackTar(filename, destination, SILENT)
+		if err != nil {
+			t.Logf("ok     %-25s rejected: %s\n", escape.label, err)
+		} else {
+			t.Logf("NOT OK %-25s accepted\n", escape.label)
+			t.Fail()
+		}
+	}
+}
+
+func TestTopLevelDir(t *testing.T) {
+	work_dir, err := ioutil.TempDir("", "unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(work_dir)
+	var archive_list = []struct {
+		label    string
+		headers  []tar.Header
+		expected string
+	}{
+		{"single top directory", []tar.Header{
+			{Name: "mysql-8.0.11-linux/bin/mysqld", Typeflag: tar.TypeReg, Mode: 0755}}, "mysql-8.0.11-linux"},
+		{"no top directory", []tar.Header{
+			{Name: "bin/mysqld", Typeflag: tar.TypeReg, Mode: 0755},
+			{Name: "lib/libmysqlclient.so.21", Typeflag: tar.TypeReg, Mode: 0644}}, ""},
+	}
+	for N, archive := range archive_list {
+		filename := fmt.Sprintf("%s/top%d.tar", work_dir, N)
+		destination := fmt.Sprintf("%s/top%d", work_dir, N)
+		os.Mkdir(destination, 0755)
+		write_tar(t, filename, archive.headers)
+		err = UnpackTar(filename, destination, SILENT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		top_dir, err := TopLevelDir(destination)
+		expected := destination
+		if archive.expected != "" {
+			expected = destination + "/" + archive.expected
+		}
+		if err == nil && top_dir == expected {
+			t.Logf("ok     %-25s %s\n", archive.label, top_dir)
+		} else {
+			t.Logf("NOT OK %-25s %s (expected: %s) %v\n", archive.label, top_dir, expected, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	var name_list = []struct {
+		name     string
+		expected bool
+	}{
+		{"mysql-8.0.11-linux/mysql-test/t/alias.test", true},
+		{"mysql-8.0.11-linux/mysql-test/", true},
+		{"mysql-8.0.11-linux/bin/mysqld-debug", true},
+		{"mysql-8.0.11-linux/lib/libmysqlclient.a", true},
+		{"mysql-8.0.11-linux/lib/plugin/debug/semisync_master.so", true},
+		{"mysql-8.0.11-linux/bin/mysqld", false},
+		{"mysql-8.0.11-linux/lib/plugin/semisync_master.so", false},
+		{"mysql-8.0.11-linux/lib/libmysqlclient.so.21", false},
+		{"mysql-8.0.11-linux/share/mysql-test-run.txt", false},
+	}
+	for _, item := range name_list {
+		found := Excluded(item.name, SlimExcludePatterns)
+		if found == item.expected {
+			t.Logf("ok     %-55s %v\n", item.name, found)
+		} else {
+			t.Logf("NOT OK %-55s %v (expected: %v)\n", item.name, found, item.expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestUnpackSlim(t *testing.T) {
+	work_dir, err := ioutil.TempDir("", "unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(work_dir)
+	write_tar(t, work_dir+"/slim.tar", []tar.Header{
+		{Name: "mysql/bin/mysqld", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "mysql/bin/mysqld-debug", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "mysql/bin/mysqld-debug-copy", Typeflag: tar.TypeLink, Linkname: "mysql/bin/mysqld-debug"},
+		{Name: "mysql/mysql-test/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "mysql/mysql-test/mtr", Typeflag: tar.TypeReg, Mode: 0755},
+	})
+	destination := work_dir + "/slim"
+	os.Mkdir(destination, 0755)
+	saved, err := UnpackTarExcluding(work_dir+"/slim.tar", destination, SILENT, nil, SlimExcludePatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected_saved := int64(len("mysql/bin/mysqld-debug") + len("mysql/mysql-test/mtr"))
+	var results = []struct {
+		label  string
+		result bool
+	}{
+		{"file extracted", file_exists(destination + "/mysql/bin/mysqld")},
+		{"debug binary excluded", !file_exists(destination + "/mysql/bin/mysqld-debug")},
+		{"hard link to excluded file", !file_exists(destination + "/mysql/bin/mysqld-debug-copy")},
+		{"directory excluded", !file_exists(destination + "/mysql/mysql-test")},
+		{"space saved", saved == expected_saved},
+	}
+	for _, r := range results {
+		if r.result {
+			t.Logf("ok     %s\n", r.label)
+		} else {
+			t.Logf("NOT OK %s\n", r.label)
+			t.Fail()
+		}
+	}
+}